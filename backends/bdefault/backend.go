@@ -1,8 +1,11 @@
 package bdefault
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nyxtom/broadcast/server"
 )
@@ -21,9 +24,20 @@ func (b *DefaultBackend) ping(data interface{}, client server.ProtocolClient) er
 	return nil
 }
 
+// info will reply with the named sections of the server status (INFO [section ...]), every
+// section when none are given
 func (b *DefaultBackend) info(data interface{}, client server.ProtocolClient) error {
-	status, _ := b.app.Status()
-	client.WriteJson(status)
+	status, err := b.app.Status()
+	if err != nil {
+		return err
+	}
+
+	sections, err := status.Sections(readStrings(data)...)
+	if err != nil {
+		return err
+	}
+
+	client.WriteJson(sections)
 	client.Flush()
 	return nil
 }
@@ -74,12 +88,212 @@ func (b *DefaultBackend) echo(data interface{}, client server.ProtocolClient) er
 	}
 }
 
+// auth will authenticate the client as the given user, or the default user when only a password is given
+func (b *DefaultBackend) auth(data interface{}, client server.ProtocolClient) error {
+	args := readStrings(data)
+	if len(args) == 1 {
+		args = []string{server.DefaultUser, args[0]}
+	} else if len(args) != 2 {
+		client.WriteError(errors.New("AUTH takes 1 or 2 parameters (AUTH [username] password)"))
+		client.Flush()
+		return nil
+	}
+
+	err := b.app.Authenticate(client, args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	client.WriteString("OK")
+	client.Flush()
+	return nil
+}
+
+// client will run the CLIENT subcommands used to inspect, name and kill client connections
+func (b *DefaultBackend) client(data interface{}, client server.ProtocolClient) error {
+	args := readStrings(data)
+	if len(args) == 0 {
+		client.WriteError(errors.New("CLIENT takes a subcommand (LIST, KILL, SETNAME, GETNAME, ID)"))
+		client.Flush()
+		return nil
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "LIST":
+		lines := make([]string, 0)
+		b.app.Clients().Each(func(c server.ProtocolClient) bool {
+			lines = append(lines, c.Info().String())
+			return true
+		})
+		client.WriteBytes([]byte(strings.Join(lines, "\n")))
+	case "KILL":
+		return b.clientKill(args[1:], client)
+	case "SETNAME":
+		if len(args) != 2 {
+			client.WriteError(errors.New("CLIENT SETNAME takes 1 parameter (CLIENT SETNAME name)"))
+		} else if strings.ContainsAny(args[1], " \n") {
+			client.WriteError(errors.New("client names cannot contain spaces or newlines"))
+		} else {
+			client.SetName(args[1])
+			client.WriteString("OK")
+		}
+	case "GETNAME":
+		if name := client.Name(); len(name) > 0 {
+			client.WriteBytes([]byte(name))
+		} else {
+			client.WriteNull()
+		}
+	case "ID":
+		client.WriteInt64(int64(client.Id()))
+	default:
+		client.WriteError(fmt.Errorf("unknown CLIENT subcommand '%s'", args[0]))
+	}
+
+	client.Flush()
+	return nil
+}
+
+// slowlog will reply with the newest entries of the slow log (SLOWLOG GET [count]), the number of
+// entries (SLOWLOG LEN) or discard every entry (SLOWLOG RESET)
+func (b *DefaultBackend) slowlog(data interface{}, client server.ProtocolClient) error {
+	args := readStrings(data)
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		count := 10
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return errors.New("SLOWLOG GET count must be an integer")
+			}
+			count = n
+		}
+
+		entries := b.app.SlowLog().Entries(count)
+		client.WriteLen('*', len(entries))
+		for _, e := range entries {
+			client.WriteLen('*', 5)
+			client.WriteInt64(int64(e.Id))
+			client.WriteInt64(e.Time.Unix())
+			client.WriteInt64(int64(e.Duration / time.Microsecond))
+			client.WriteLen('*', len(e.Args)+1)
+			client.WriteBytes([]byte(e.Cmd))
+			for _, arg := range e.Args {
+				client.WriteBytes([]byte(arg))
+			}
+			client.WriteBytes([]byte(e.Addr))
+		}
+	case "LEN":
+		client.WriteInt64(int64(b.app.SlowLog().Len()))
+	case "RESET":
+		b.app.SlowLog().Reset()
+		client.WriteString("OK")
+	default:
+		client.WriteError(fmt.Errorf("unknown SLOWLOG subcommand '%s'", args[0]))
+	}
+
+	client.Flush()
+	return nil
+}
+
+// clientKill will close the client connections matching the given address, or the given
+// ID, ADDR and NAME filters, replying with the number of connections that were closed
+func (b *DefaultBackend) clientKill(args []string, client server.ProtocolClient) error {
+	if len(args) == 1 {
+		args = []string{"ADDR", args[0]}
+	} else if len(args) == 0 || len(args)%2 != 0 {
+		client.WriteError(errors.New("CLIENT KILL takes an address or filters (CLIENT KILL addr | CLIENT KILL [ID id] [ADDR addr] [NAME name])"))
+		client.Flush()
+		return nil
+	}
+
+	var id uint64
+	var addr, name string
+	var byId, byAddr, byName bool
+	for i := 0; i < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "ID":
+			n, err := strconv.ParseUint(args[i+1], 10, 64)
+			if err != nil {
+				client.WriteError(fmt.Errorf("invalid client id '%s'", args[i+1]))
+				client.Flush()
+				return nil
+			}
+			id, byId = n, true
+		case "ADDR":
+			addr, byAddr = args[i+1], true
+		case "NAME":
+			name, byName = args[i+1], true
+		default:
+			client.WriteError(fmt.Errorf("unknown CLIENT KILL filter '%s'", args[i]))
+			client.Flush()
+			return nil
+		}
+	}
+
+	matches := make([]server.ProtocolClient, 0)
+	b.app.Clients().Each(func(c server.ProtocolClient) bool {
+		if (!byId || c.Id() == id) && (!byAddr || c.Address() == addr) && (!byName || c.Name() == name) {
+			matches = append(matches, c)
+		}
+		return true
+	})
+
+	if len(matches) == 0 {
+		client.WriteError(errors.New("no such client"))
+		client.Flush()
+		return nil
+	}
+
+	// reply before closing as the client may have killed itself
+	client.WriteInt64(int64(len(matches)))
+	client.Flush()
+	for _, c := range matches {
+		c.Close()
+	}
+	return nil
+}
+
+// readStrings will read the arguments as strings regardless of the protocol they were sent with
+func readStrings(data interface{}) []string {
+	switch d := data.(type) {
+	case [][]byte:
+		s := make([]string, len(d))
+		for i, v := range d {
+			s[i] = string(v)
+		}
+		return s
+	case []interface{}:
+		s := make([]string, len(d))
+		for i, v := range d {
+			if b, ok := v.([]byte); ok {
+				s[i] = string(b)
+			} else {
+				s[i] = fmt.Sprintf("%v", v)
+			}
+		}
+		return s
+	}
+
+	return nil
+}
+
 func RegisterBackend(app *server.BroadcastServer) (server.Backend, error) {
 	backend := new(DefaultBackend)
-	app.RegisterCommand(server.Command{"PING", "Pings the server for a response", "", false}, backend.ping)
-	app.RegisterCommand(server.Command{"ECHO", "Echos back a message sent", "ECHO \"hello world\"", false}, backend.echo)
-	app.RegisterCommand(server.Command{"INFO", "Current server status and information", "", false}, backend.info)
-	app.RegisterCommand(server.Command{"CMDS", "List of available commands supported by the server", "", false}, backend.help)
+	app.RegisterCommand(server.Command{Name: "PING", Description: "Pings the server for a response", Usage: "PING [message]",
+		MaxArgs: 1}, backend.ping)
+	app.RegisterCommand(server.Command{Name: "ECHO", Description: "Echos back a message sent", Usage: "ECHO \"hello world\"",
+		MaxArgs: server.Variadic}, backend.echo)
+	app.RegisterCommand(server.Command{Name: "INFO", Description: "Current server status and information, optionally limited to the given sections", Usage: "INFO [server|clients|memory|commandstats|backends ...]",
+		MaxArgs: server.Variadic, Flags: server.FlagReadOnly}, backend.info)
+	app.RegisterCommand(server.Command{Name: "CMDS", Description: "List of available commands supported by the server",
+		Flags: server.FlagReadOnly}, backend.help)
+	app.RegisterCommand(server.Command{Name: "AUTH", Description: "Authenticates the connection as the given user", Usage: "AUTH [username] password",
+		MinArgs: 1, MaxArgs: 2}, backend.auth)
+	app.RegisterCommand(server.Command{Name: "CLIENT", Description: "Lists, names and kills client connections", Usage: "CLIENT LIST | CLIENT KILL [ID id] [ADDR addr] [NAME name] | CLIENT SETNAME name | CLIENT GETNAME | CLIENT ID",
+		MinArgs: 1, MaxArgs: server.Variadic, Flags: server.FlagAdmin | server.FlagDirect}, backend.client)
+	app.RegisterCommand(server.Command{Name: "SLOWLOG", Description: "Lists, counts and resets the commands that took longer than the slow log threshold", Usage: "SLOWLOG GET [count] | SLOWLOG LEN | SLOWLOG RESET",
+		MinArgs: 1, MaxArgs: 2, Flags: server.FlagAdmin}, backend.slowlog)
+	app.RegisterCategory("connection", "PING", "ECHO", "AUTH")
 	backend.app = app
 	return backend, nil
 }
@@ -0,0 +1,178 @@
+package bdefault
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nyxtom/broadcast/server"
+)
+
+// pipeListener hands the server end of pipe connections to the server as they are dialed
+type pipeListener struct {
+	conns chan net.Conn
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) { return <-l.conns, nil }
+func (l *pipeListener) Close() error              { return nil }
+func (l *pipeListener) Addr() net.Addr            { return &net.UnixAddr{Name: "pipe", Net: "unix"} }
+
+// dial will connect a new client to the server
+func (l *pipeListener) dial() *server.NetworkClient {
+	conn, peer := net.Pipe()
+	l.conns <- conn
+	client, _ := server.NewNetworkClient(peer)
+	return client
+}
+
+// newTestServer will create a server with the default backend accepting pipe connections, the
+// server is left running as the process exits once the tests complete
+func newTestServer(t *testing.T) (*server.BroadcastServer, *pipeListener) {
+	app := server.NewBroadcastServer()
+	if _, err := RegisterBackend(app); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &pipeListener{make(chan net.Conn)}
+	if _, err := app.AddNetListener(l, server.NewDefaultBroadcastServerProtocol()); err != nil {
+		t.Fatal(err)
+	}
+	go app.AcceptConnections()
+	return app, l
+}
+
+// send will write the command as an array of bulk strings
+func send(client *server.NetworkClient, args ...string) {
+	b := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b = append(b, "$"+strconv.Itoa(len(arg))+"\r\n"+arg+"\r\n"...)
+	}
+	go client.Conn.Write(b)
+}
+
+// reply will read the next reply off of the connection
+func reply(t *testing.T, client *server.NetworkClient) (interface{}, error) {
+	t.Helper()
+	client.Conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return client.ReadInterface()
+}
+
+func TestClientKillSelf(t *testing.T) {
+	_, l := newTestServer(t)
+	client := l.dial()
+	defer client.Close()
+
+	send(client, "CLIENT", "ID")
+	id, err := reply(t, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the reply is written before the connection is closed
+	send(client, "CLIENT", "KILL", "ID", strconv.FormatInt(id.(int64), 10))
+	if v, err := reply(t, client); err != nil || v != int64(1) {
+		t.Fatalf("expected 1 client to be killed, got %#v (%v)", v, err)
+	}
+	if _, err := reply(t, client); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestClientKillOther(t *testing.T) {
+	_, l := newTestServer(t)
+	client, other := l.dial(), l.dial()
+	defer client.Close()
+	defer other.Close()
+
+	send(other, "CLIENT", "SETNAME", "other")
+	if v, err := reply(t, other); err != nil || v != "OK" {
+		t.Fatalf("expected the name to be set, got %#v (%v)", v, err)
+	}
+
+	send(client, "CLIENT", "KILL", "NAME", "other")
+	if v, err := reply(t, client); err != nil || v != int64(1) {
+		t.Fatalf("expected 1 client to be killed, got %#v (%v)", v, err)
+	}
+	if _, err := reply(t, other); err == nil {
+		t.Fatal("expected the other connection to be closed")
+	}
+
+	send(client, "PING")
+	if v, err := reply(t, client); err != nil || v != "PONG" {
+		t.Fatalf("expected the connection to be served, got %#v (%v)", v, err)
+	}
+}
+
+func TestSlowLog(t *testing.T) {
+	app, l := newTestServer(t)
+	app.SetSlowLog(0, 8)
+	client := l.dial()
+	defer client.Close()
+
+	send(client, "ECHO", "a")
+	reply(t, client)
+	send(client, "SLOWLOG", "LEN")
+	if v, err := reply(t, client); err != nil || v != int64(1) {
+		t.Fatalf("expected 1 entry, got %#v (%v)", v, err)
+	}
+
+	// the newest entries come first, each with its id, time, duration, command and address
+	send(client, "SLOWLOG", "GET", "1")
+	v, err := reply(t, client)
+	entries, ok := v.([]interface{})
+	if err != nil || !ok || len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %#v (%v)", v, err)
+	}
+	entry, ok := entries[0].([]interface{})
+	if !ok || len(entry) != 5 || entry[0] != int64(1) {
+		t.Fatalf("expected the entry of SLOWLOG LEN, got %#v", entries[0])
+	} else if cmd, ok := entry[3].([]interface{}); !ok || len(cmd) != 2 || string(cmd[0].([]byte)) != "SLOWLOG" || string(cmd[1].([]byte)) != "LEN" {
+		t.Fatalf("expected the command and its arguments, got %#v", entry[3])
+	} else if string(entry[4].([]byte)) != "pipe" {
+		t.Fatalf("expected the address of the client, got %#v", entry[4])
+	}
+
+	send(client, "SLOWLOG", "RESET")
+	if v, err := reply(t, client); err != nil || v != "OK" {
+		t.Fatalf("expected the slow log to be reset, got %#v (%v)", v, err)
+	}
+	send(client, "SLOWLOG", "GET")
+	if v, err := reply(t, client); err != nil || len(v.([]interface{})) != 1 {
+		t.Fatalf("expected only the entry of SLOWLOG RESET, got %#v (%v)", v, err)
+	}
+
+	send(client, "SLOWLOG", "NOPE")
+	if v, err := reply(t, client); err != nil || v.(error).Error() != "ERR unknown SLOWLOG subcommand 'NOPE'" {
+		t.Fatalf("expected an unknown subcommand error, got %#v (%v)", v, err)
+	}
+}
+
+func TestInfoCommandStats(t *testing.T) {
+	_, l := newTestServer(t)
+	client := l.dial()
+	defer client.Close()
+
+	send(client, "PING")
+	reply(t, client)
+	send(client, "AUTH", "nobody", "secret")
+	reply(t, client)
+	send(client, "INFO", "commandstats")
+	v, err := reply(t, client)
+	sections, ok := v.(map[string]interface{})
+	if err != nil || !ok || len(sections) != 1 {
+		t.Fatalf("expected only the commandstats section, got %#v (%v)", v, err)
+	}
+
+	stats := sections["commandstats"].(map[string]interface{})
+	if ping := stats["PING"].(map[string]interface{}); ping["Calls"] != float64(1) || ping["Errors"] != float64(0) || len(ping["Latency"].([]interface{})) != 17 {
+		t.Fatalf("expected 1 call of PING with its latency histogram, got %v", ping)
+	} else if auth := stats["AUTH"].(map[string]interface{}); auth["Calls"] != float64(1) || auth["Errors"] != float64(1) {
+		t.Fatalf("expected 1 failed call of AUTH, got %v", auth)
+	}
+
+	send(client, "INFO", "nope")
+	if v, err := reply(t, client); err != nil || v.(error).Error() != "ERR unknown INFO section 'nope'" {
+		t.Fatalf("expected an unknown section error, got %#v (%v)", v, err)
+	}
+}
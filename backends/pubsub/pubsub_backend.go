@@ -8,9 +8,11 @@ import (
 
 type PubSubBackend struct {
 	server.Backend
+	sync.RWMutex
 
-	app    *server.BroadcastServer
-	topics map[string]*TopicChannel
+	app      *server.BroadcastServer
+	topics   map[string]*TopicChannel
+	watching map[uint64]struct{} // subscribed clients that are removed from every topic once they exit
 }
 
 var empty struct{}
@@ -19,7 +21,7 @@ type TopicChannel struct {
 	sync.Mutex
 
 	size    int
-	clients map[string]struct{}
+	clients map[uint64]struct{} // subscribed clients keyed by their unique id
 }
 
 // subscribe will add the given protocol client to the channel to subscribe to
@@ -28,42 +30,75 @@ func (b *PubSubBackend) subscribe(data interface{}, client server.ProtocolClient
 	if len(d) < 1 {
 		return nil
 	} else {
+		b.Lock()
+		defer b.Unlock()
+		id := client.Id()
 		for _, k := range d {
 			key := string(k)
 			if topic, ok := b.topics[key]; ok {
 				topic.Lock()
-				id := client.Address()
 				if _, ok = topic.clients[id]; !ok {
 					topic.clients[id] = empty
 					topic.size++
+					client.AddSubscriptions(1)
 				}
 				topic.Unlock()
 			} else {
 				topic := new(TopicChannel)
-				topic.clients = make(map[string]struct{})
+				topic.clients = make(map[uint64]struct{})
 				topic.size = 1
-				topic.clients[client.Address()] = empty
+				topic.clients[id] = empty
 				b.topics[key] = topic
+				client.AddSubscriptions(1)
 			}
 		}
 
+		if _, ok := b.watching[id]; !ok {
+			b.watching[id] = empty
+			go b.watch(client)
+		}
+
 		return nil
 	}
 }
 
+// watch will wait for the subscribed client to exit and remove it from every topic
+func (b *PubSubBackend) watch(client server.ProtocolClient) {
+	<-client.WaitExit()
+
+	b.Lock()
+	defer b.Unlock()
+	id := client.Id()
+	delete(b.watching, id)
+	for key, topic := range b.topics {
+		topic.Lock()
+		if _, ok := topic.clients[id]; ok {
+			delete(topic.clients, id)
+			topic.size--
+		}
+		if topic.size <= 0 {
+			delete(b.topics, key)
+		}
+		topic.Unlock()
+	}
+}
+
 func (b *PubSubBackend) unsubscribe(data interface{}, client server.ProtocolClient) error {
 	d, _ := data.([][]byte)
 	if len(d) < 1 {
 		return nil
 	} else {
+		b.RLock()
+		defer b.RUnlock()
+		id := client.Id()
 		for _, k := range d {
 			key := string(k)
 			if topic, ok := b.topics[key]; ok {
 				topic.Lock()
-				id := client.Address()
 				if _, ok = topic.clients[id]; ok {
 					delete(topic.clients, id)
 					topic.size--
+					client.AddSubscriptions(-1)
 				}
 				topic.Unlock()
 			}
@@ -81,14 +116,19 @@ func (b *PubSubBackend) publish(data interface{}, client server.ProtocolClient)
 	} else {
 		key := string(d[0])
 
-		if topic, ok := b.topics[key]; ok {
+		b.RLock()
+		topic, ok := b.topics[key]
+		b.RUnlock()
+		if ok {
 			topic.Lock()
 			defer topic.Unlock()
 			if topic.size > 0 {
-				deletions := make([]string, 0)
+				deletions := make([]uint64, 0)
 				for c, _ := range topic.clients {
 					if sClient, ok := b.app.GetClient(c); ok {
 						go func() {
+							sClient.LockWrites()
+							defer sClient.UnlockWrites()
 							sClient.WriteBulk(d)
 							sClient.Flush()
 						}()
@@ -100,6 +140,7 @@ func (b *PubSubBackend) publish(data interface{}, client server.ProtocolClient)
 				// remove any stragglers
 				for _, c := range deletions {
 					delete(topic.clients, c)
+					topic.size--
 				}
 			}
 		}
@@ -110,11 +151,15 @@ func (b *PubSubBackend) publish(data interface{}, client server.ProtocolClient)
 
 func RegisterBackend(app *server.BroadcastServer) (server.Backend, error) {
 	backend := new(PubSubBackend)
-	app.RegisterCommand(server.Command{"PUBLISH", "Publishes to a specified topic given the data/arguments", "PUBLISH topic message", true}, backend.publish)
-	app.RegisterCommand(server.Command{"SUBSCRIBE", "Subscribes to a specified topic", "SUBSCRIBE topic [topic ...]", true}, backend.subscribe)
-	app.RegisterCommand(server.Command{"UNSUBSCRIBE", "Unsubscribes from a specified topic", "UNSUBSCRIBE topic [topic ...]", true}, backend.unsubscribe)
+	app.RegisterCommand(server.Command{Name: "PUBLISH", Description: "Publishes to a specified topic given the data/arguments", Usage: "PUBLISH topic message", FireForget: true,
+		MinArgs: 2, MaxArgs: server.Variadic, Flags: server.FlagPubSub}, backend.publish)
+	app.RegisterCommand(server.Command{Name: "SUBSCRIBE", Description: "Subscribes to a specified topic", Usage: "SUBSCRIBE topic [topic ...]", FireForget: true,
+		MinArgs: 1, MaxArgs: server.Variadic, Flags: server.FlagPubSub | server.FlagBlocking}, backend.subscribe)
+	app.RegisterCommand(server.Command{Name: "UNSUBSCRIBE", Description: "Unsubscribes from a specified topic", Usage: "UNSUBSCRIBE topic [topic ...]", FireForget: true,
+		MinArgs: 1, MaxArgs: server.Variadic, Flags: server.FlagPubSub}, backend.unsubscribe)
 	backend.app = app
 	backend.topics = make(map[string]*TopicChannel)
+	backend.watching = make(map[uint64]struct{})
 	return backend, nil
 }
 
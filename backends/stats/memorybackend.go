@@ -20,6 +20,19 @@ type MemoryBackend struct {
 	lastTimeStamp     time.Time
 }
 
+// Snapshot is a copy of the counters, values and set cardinalities tracked at a point in time
+type Snapshot struct {
+	Counters map[string]CounterSnapshot // counters by key
+	Values   map[string]int64           // values by key
+	Sets     map[string]int64           // number of members of each set by key
+}
+
+// CounterSnapshot is a copy of a single counter
+type CounterSnapshot struct {
+	Value         int64   // total for the counter since the last flush
+	RatePerSecond float64 // avg rate per second as of the last flush
+}
+
 type Counter struct {
 	Value int64 // total for the given counter
 	Rate  *CounterRate
@@ -334,6 +347,37 @@ func (mem *MemoryBackend) SInter(names []string) (map[string]struct{}, error) {
 	return results, nil
 }
 
+// Sizes will return the number of counters, values and sets being tracked
+func (mem *MemoryBackend) Sizes() (int, int, int, error) {
+	mem.Lock()
+	counters, values := len(mem.counters), len(mem.values)
+	mem.Unlock()
+
+	mem.setLock.Lock()
+	defer mem.setLock.Unlock()
+	return counters, values, len(mem.sets), nil
+}
+
+// Snapshot will copy the counters, values and set cardinalities being tracked
+func (mem *MemoryBackend) Snapshot() (*Snapshot, error) {
+	snapshot := &Snapshot{make(map[string]CounterSnapshot), make(map[string]int64), make(map[string]int64)}
+	mem.Lock()
+	for k, v := range mem.counters {
+		snapshot.Counters[k] = CounterSnapshot{v.Value, v.Rate.RatePerSecond}
+	}
+	for k, v := range mem.values {
+		snapshot.Values[k] = v
+	}
+	mem.Unlock()
+
+	mem.setLock.Lock()
+	defer mem.setLock.Unlock()
+	for k, v := range mem.sets {
+		snapshot.Sets[k] = int64(len(v))
+	}
+	return snapshot, nil
+}
+
 func (mem *MemoryBackend) Keys(pattern string) ([]string, error) {
 	mem.Lock()
 	defer mem.Unlock()
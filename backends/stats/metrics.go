@@ -1,8 +1,6 @@
 package stats
 
 import (
-	"errors"
-	"strconv"
 	"time"
 
 	"github.com/nyxtom/broadcast/server"
@@ -40,6 +38,9 @@ type Metrics interface {
 	SUnion(names []string) (map[string]struct{}, error)
 
 	Keys(pattern string) ([]string, error)
+
+	Sizes() (counters int, values int, sets int, err error)
+	Snapshot() (*Snapshot, error)
 }
 
 type StatsBackend struct {
@@ -50,506 +51,247 @@ type StatsBackend struct {
 	mem   Metrics
 }
 
-func (stats *StatsBackend) FlushInt(i int64, err error, client server.ProtocolClient) error {
-	if err != nil {
-		return err
-	}
-	client.WriteInt64(i)
-	client.Flush()
-	return nil
-}
-
-func (stats *StatsBackend) FlushNil(client server.ProtocolClient) error {
-	client.WriteNull()
-	client.Flush()
-	return nil
-}
-
-func (stats *StatsBackend) readString(d []byte) (string, error) {
-	return string(d), nil
-}
-
-func (stats *StatsBackend) readInt64(d []byte) (int64, error) {
-	return strconv.ParseInt(string(d), 10, 64)
-}
-
-func (stats *StatsBackend) readStringInt64(d [][]byte) (string, int64, error) {
-	key, err := stats.readString(d[0])
-	if err != nil {
-		return "", 0, err
-	}
-	value, err := stats.readInt64(d[1])
-	if err != nil {
-		return "", 0, err
+func (stats *StatsBackend) Get(key string) (*int64, error) {
+	i, err := stats.mem.Get(key)
+	if err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
-
-	return key, value, nil
+	return &i, nil
 }
 
-func (stats *StatsBackend) Set(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) < 2 {
-		client.WriteError(errors.New("SET takes at least 2 parameters (i.e. key to set and value to set to)"))
-		client.Flush()
-		return nil
-	} else {
-		key, value, err := stats.readStringInt64(d)
+func (stats *StatsBackend) Del(keys ...string) (int64, error) {
+	i := int64(0)
+	for _, key := range keys {
+		i2, err := stats.mem.Del(key)
 		if err != nil {
-			return err
+			return 0, err
 		}
-		i, err := stats.mem.Set(key, value)
-		return stats.FlushInt(i, err, client)
+		i += i2
 	}
+	return i, nil
 }
 
-func (stats *StatsBackend) SetNx(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) < 2 {
-		client.WriteError(errors.New("SETNX takes at least 2 parameters (i.e. key to set and value to set to, if not already set)"))
-		client.Flush()
-		return nil
-	} else {
-		key, value, err := stats.readStringInt64(d)
-		if err != nil {
-			return err
-		}
-		i, err := stats.mem.SetNx(key, value)
-		return stats.FlushInt(i, err, client)
+func (stats *StatsBackend) Incr(key string, values ...int64) (int64, error) {
+	if len(values) > 0 {
+		return stats.mem.IncrBy(key, values[0])
 	}
+	return stats.mem.Incr(key)
 }
 
-func (stats *StatsBackend) Get(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) == 0 {
-		client.WriteError(errors.New("GET takes at least 1 parameter (i.e. key to get)"))
-		client.Flush()
-		return nil
-	} else {
-		key, err := stats.readString(d[0])
-		if err != nil {
-			return err
-		}
-		i, err := stats.mem.Get(key)
-		if err == ErrNotFound {
-			return stats.FlushNil(client)
-		}
-		return stats.FlushInt(i, err, client)
+func (stats *StatsBackend) Decr(key string, values ...int64) (int64, error) {
+	if len(values) > 0 {
+		return stats.mem.DecrBy(key, values[0])
 	}
+	return stats.mem.Decr(key)
 }
 
-func (stats *StatsBackend) Exists(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) == 0 {
-		client.WriteError(errors.New("EXISTS takes at least 1 parameter (i.e. key to find)"))
-		client.Flush()
-		return nil
+func (stats *StatsBackend) Count(key string, values ...int64) error {
+	var err error
+	if len(values) > 0 {
+		_, err = stats.mem.CounterBy(key, values[0])
 	} else {
-		key, err := stats.readString(d[0])
-		if err != nil {
-			return err
-		}
-		i, err := stats.mem.Exists(key)
-		return stats.FlushInt(i, err, client)
+		_, err = stats.mem.Counter(key)
 	}
+	return err
 }
 
-func (stats *StatsBackend) Del(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) == 0 {
-		client.WriteError(errors.New("DEL takes at least 1 parameter (i.e. key to delete)"))
-		client.Flush()
-		return nil
-	} else {
-		i := int64(0)
-		for _, k := range d {
-			key, err := stats.readString(k)
-			if err != nil {
-				return err
-			}
-			i2, err := stats.mem.Del(key)
-			if err != nil {
-				return err
-			} else {
-				i += i2
-			}
-		}
-		return stats.FlushInt(i, nil, client)
+func (stats *StatsBackend) Keys(patterns ...string) ([]string, error) {
+	pattern := ""
+	if len(patterns) > 0 {
+		pattern = patterns[0]
 	}
+	return stats.mem.Keys(pattern)
 }
 
-func (stats *StatsBackend) Incr(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) == 0 {
-		client.WriteError(errors.New("INCR takes at least 1 parameter (i.e. key to increment)"))
-		client.Flush()
-		return nil
-	} else {
-		key, err := stats.readString(d[0])
+func (stats *StatsBackend) SAdd(key string, members ...string) (int64, error) {
+	result := int64(0)
+	for _, v := range members {
+		r, err := stats.mem.SAdd(key, v)
 		if err != nil {
-			return err
-		}
-		values := d[1:]
-		if len(values) > 0 {
-			value, err := stats.readInt64(values[0])
-			if err != nil {
-				return err
-			}
-			i, err := stats.mem.IncrBy(key, value)
-			return stats.FlushInt(i, err, client)
-		} else {
-			i, err := stats.mem.Incr(key)
-			return stats.FlushInt(i, err, client)
+			return 0, err
 		}
+		result += r
 	}
+	return result, nil
 }
 
-func (stats *StatsBackend) Decr(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) == 0 {
-		client.WriteError(errors.New("DECR takes at least 1 parameter (i.e. key to increment)"))
-		client.Flush()
-		return nil
-	} else {
-		key, err := stats.readString(d[0])
+func (stats *StatsBackend) SRem(key string, members ...string) (int64, error) {
+	result := int64(0)
+	for _, v := range members {
+		r, err := stats.mem.SRem(key, v)
 		if err != nil {
-			return err
-		}
-		values := d[1:]
-		if len(values) > 0 {
-			value, err := stats.readInt64(values[0])
-			if err != nil {
-				return err
-			}
-			i, err := stats.mem.DecrBy(key, value)
-			return stats.FlushInt(i, err, client)
-		} else {
-			i, err := stats.mem.Decr(key)
-			return stats.FlushInt(i, err, client)
+			return 0, err
+		} else if r == -1 {
+			return r, nil
 		}
+		result += r
 	}
+	return result, nil
 }
 
-func (stats *StatsBackend) Count(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) == 0 {
-		client.WriteError(errors.New("COUNTER takes at least 1 parameter (i.e. key to increment)"))
-		client.Flush()
-		return nil
-	} else {
-		key, err := stats.readString(d[0])
+// SCard will return the number of members of the set, or an array of them when given several sets
+func (stats *StatsBackend) SCard(keys ...string) (interface{}, error) {
+	results := make([]int64, len(keys))
+	for i, v := range keys {
+		r, err := stats.mem.SCard(v)
 		if err != nil {
-			return err
-		}
-		values := d[1:]
-		if len(values) > 0 {
-			value, err := stats.readInt64(values[0])
-			if err != nil {
-				return err
-			}
-			_, err = stats.mem.CounterBy(key, value)
-			return err
-		} else {
-			_, err := stats.mem.Counter(key)
-			return err
+			return nil, err
 		}
+		results[i] = r
 	}
-}
 
-func (stats *StatsBackend) Counters(data interface{}, client server.ProtocolClient) error {
-	results, err := stats.mem.Counters()
-	if err != nil {
-		client.WriteError(err)
-		client.Flush()
-		return nil
+	if len(results) > 1 {
+		return results, nil
 	}
-
-	client.WriteJson(results)
-	client.Flush()
-	return nil
+	return results[0], nil
 }
 
-func (stats *StatsBackend) Keys(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	key := ""
-	if len(d) > 0 {
-		pattern, err := stats.readString(d[0])
-		if err != nil {
-			return err
-		}
-		key = pattern
-	}
-
-	results, err := stats.mem.Keys(key)
-	if err != nil {
-		client.WriteError(err)
-		client.Flush()
-		return nil
-	}
-	client.WriteLen('*', len(results))
-	for _, k := range results {
-		client.WriteString(k)
+func (stats *StatsBackend) SDiff(key string, keys ...string) (map[string]struct{}, error) {
+	results, err := stats.mem.SMembers(key)
+	if err != nil || results == nil {
+		return nil, err
 	}
-	client.Flush()
-	return nil
-}
 
-func (stats *StatsBackend) SAdd(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	key := ""
-	if len(d) < 2 {
-		client.WriteError(errors.New("SADD takes at least 2 parameters (SADD key member)"))
-		client.Flush()
-		return nil
-	} else {
-		key = string(d[0])
-		members := d[1:]
-		result := int64(0)
-		for _, v := range members {
-			r, err := stats.mem.SAdd(key, string(v))
-			if err != nil {
-				return err
-			} else {
-				result += r
-			}
+	for _, v := range keys {
+		results, err = stats.mem.SDiff(results, v)
+		if err != nil {
+			return nil, err
+		} else if len(results) == 0 {
+			break
 		}
-
-		return stats.FlushInt(result, nil, client)
 	}
+	return results, nil
 }
 
-func (stats *StatsBackend) SRem(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	key := ""
-	if len(d) < 2 {
-		client.WriteError(errors.New("SREM takes at least 2 parameters (SREM key member)"))
-		client.Flush()
-		return nil
-	} else {
-		key = string(d[0])
-		members := d[1:]
-		result := int64(0)
-		for _, v := range members {
-			r, err := stats.mem.SRem(key, string(v))
-			if err != nil {
-				return err
-			} else if r == -1 {
-				return stats.FlushInt(r, nil, client)
-			} else {
-				result += r
-			}
+// SIsMember will return whether the member is in the set, or an array of them when given several members
+func (stats *StatsBackend) SIsMember(key string, members ...string) (interface{}, error) {
+	results := make([]int64, len(members))
+	for i, v := range members {
+		r, err := stats.mem.SIsMember(key, v)
+		if err != nil {
+			return nil, err
 		}
-
-		return stats.FlushInt(result, nil, client)
+		results[i] = r
 	}
-}
-
-func (stats *StatsBackend) SCard(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) < 1 {
-		client.WriteError(errors.New("SCARD takes at least 1 parameter (SCARD key)"))
-		client.Flush()
-		return nil
-	} else {
-		results := make([]int64, len(d))
-		for i, v := range d {
-			r, err := stats.mem.SCard(string(v))
-			if err != nil {
-				return err
-			} else {
-				results[i] = r
-			}
-		}
 
-		if len(d) > 1 {
-			client.WriteLen('*', len(d))
-			for _, v := range results {
-				client.WriteInt64(v)
-			}
-		} else {
-			client.WriteInt64(results[0])
-		}
-		client.Flush()
-		return nil
+	if len(results) > 1 {
+		return results, nil
 	}
+	return results[0], nil
 }
 
-func (stats *StatsBackend) SDiff(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) < 2 {
-		client.WriteError(errors.New("SDIFF requires at least 2 parameters (SDIFF key [key ...])"))
-		client.Flush()
-		return nil
-	} else {
-		results, err := stats.mem.SMembers(string(d[0]))
-		if err != nil {
-			return err
-		} else if results == nil {
-			client.WriteNull()
-			client.Flush()
-			return nil
-		} else {
-			for _, v := range d[1:] {
-				results, err = stats.mem.SDiff(results, string(v))
-				if err != nil {
-					return err
-				} else if len(results) == 0 {
-					break
-				}
-			}
-
-			client.WriteLen('*', len(results))
-			for k, _ := range results {
-				client.WriteString(k)
-			}
-			client.Flush()
-			return nil
-		}
-	}
+func (stats *StatsBackend) SInter(keys ...string) (map[string]struct{}, error) {
+	return stats.mem.SInter(keys)
 }
 
-func (stats *StatsBackend) SMembers(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) == 0 {
-		client.WriteError(errors.New("SMEMBERS takes 1 parameter (SMEMBERS key)"))
-		client.Flush()
-		return nil
-	} else {
-		values, err := stats.mem.SMembers(string(d[0]))
-		if err != nil {
-			return err
-		}
-
-		if values == nil {
-			client.WriteNull()
-			client.Flush()
-			return nil
-		}
-
-		client.WriteLen('*', len(values))
-		for k, _ := range values {
-			client.WriteString(k)
-		}
-		client.Flush()
-		return nil
-	}
+// SUnion will return the members of every given set, missing sets have no members so the union is
+// an empty set (written as an empty array) rather than nil (written as null) when none exist
+func (stats *StatsBackend) SUnion(keys ...string) (map[string]struct{}, error) {
+	return stats.mem.SUnion(keys)
 }
 
-func (stats *StatsBackend) SIsMember(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) < 2 {
-		client.WriteError(errors.New("SISMEMBER takes 2 parameters (SISMEMBER key member)"))
-		client.Flush()
-		return nil
-	} else {
-		key := string(d[0])
-		results := make([]int64, len(d)-1)
-		for i, v := range d[1:] {
-			result, err := stats.mem.SIsMember(key, string(v))
-			if err != nil {
-				return err
-			}
-			results[i] = result
-		}
-
-		if len(results) > 1 {
-			client.WriteLen('*', len(results))
-			for _, v := range results {
-				client.WriteInt64(v)
-			}
-		} else {
-			client.WriteInt64(results[0])
-		}
-		client.Flush()
-		return nil
+func RegisterBackend(app *server.BroadcastServer) (server.Backend, error) {
+	backend := new(StatsBackend)
+	mem, err := NewMemoryBackend()
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (stats *StatsBackend) SInter(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) < 2 {
-		client.WriteError(errors.New("SINTER takes at least 2 parameters (SINTER key [key ...])"))
-		client.Flush()
-		return nil
-	} else {
-		keys := make([]string, len(d))
-		for i, v := range d {
-			keys[i] = string(v)
-		}
-		results, err := stats.mem.SInter(keys)
-		if err != nil {
-			return err
-		}
-
-		if results == nil {
-			client.WriteNull()
-			client.Flush()
-			return nil
-		}
+	backend.mem = mem
 
-		client.WriteLen('*', len(results))
-		for k, _ := range results {
-			client.WriteString(k)
+	key := []server.ArgType{server.ArgKey}
+	keyInteger := []server.ArgType{server.ArgKey, server.ArgInteger}
+	keyMember := []server.ArgType{server.ArgKey, server.ArgString}
+	commands := []struct {
+		cmd server.Command
+		fn  interface{}
+	}{
+		{server.Command{Name: "COUNT", Description: "Increments a key that resets itself to 0 on each flush routine.", Usage: "COUNT foo [124]", FireForget: true,
+			MinArgs: 1, MaxArgs: 2, Flags: server.FlagWrite, FirstKey: 1, Args: keyInteger}, backend.Count},
+		{server.Command{Name: "COUNTERS", Description: "Returns the list of active counters.",
+			Flags: server.FlagReadOnly}, mem.Counters},
+		{server.Command{Name: "INCR", Description: "Increments a key by the specified value or by default 1.", Usage: "INCR key [1]",
+			MinArgs: 1, MaxArgs: 2, Flags: server.FlagWrite, FirstKey: 1, Args: keyInteger}, backend.Incr},
+		{server.Command{Name: "DECR", Description: "Decrements a key by the specified value or by default 1.", Usage: "DECR key [1]",
+			MinArgs: 1, MaxArgs: 2, Flags: server.FlagWrite, FirstKey: 1, Args: keyInteger}, backend.Decr},
+		{server.Command{Name: "DEL", Description: "Deletes a key from the values or counters list or both.", Usage: "DEL key [key ...]",
+			MinArgs: 1, MaxArgs: server.Variadic, Flags: server.FlagWrite, FirstKey: 1, LastKey: -1, Args: key}, backend.Del},
+		{server.Command{Name: "EXISTS", Description: "Determines if the given key exists from the values.", Usage: "EXISTS key",
+			MinArgs: 1, MaxArgs: 1, Flags: server.FlagReadOnly, FirstKey: 1, Args: key}, mem.Exists},
+		{server.Command{Name: "GET", Description: "Gets the specified key from the values.", Usage: "GET key",
+			MinArgs: 1, MaxArgs: 1, Flags: server.FlagReadOnly, FirstKey: 1, Args: key}, backend.Get},
+		{server.Command{Name: "SET", Description: "Sets the specified key to the specified value in values.", Usage: "SET key 1234",
+			MinArgs: 2, MaxArgs: 2, Flags: server.FlagWrite, FirstKey: 1, Args: keyInteger}, mem.Set},
+		{server.Command{Name: "SETNX", Description: "Sets the specified key to the given value only if the key is not already set.", Usage: "SETNX key 1234",
+			MinArgs: 2, MaxArgs: 2, Flags: server.FlagWrite, FirstKey: 1, Args: keyInteger}, mem.SetNx},
+		{server.Command{Name: "KEYS", Description: "Returns the list of keys available or by pattern", Usage: "KEYS [pattern]",
+			MaxArgs: 1, Flags: server.FlagReadOnly}, backend.Keys},
+
+		// set commands
+		{server.Command{Name: "SADD", Description: "Adds one or more members to a set", Usage: "SADD key member [member ...]",
+			MinArgs: 2, MaxArgs: server.Variadic, Flags: server.FlagWrite, FirstKey: 1, Args: keyMember}, backend.SAdd},
+		{server.Command{Name: "SREM", Description: "Removes one or more members from a set", Usage: "SREM key member [member ...]",
+			MinArgs: 2, MaxArgs: server.Variadic, Flags: server.FlagWrite, FirstKey: 1, Args: keyMember}, backend.SRem},
+		{server.Command{Name: "SCARD", Description: "Gets the number of members from a set", Usage: "SCARD key [key ...]",
+			MinArgs: 1, MaxArgs: server.Variadic, Flags: server.FlagReadOnly, FirstKey: 1, LastKey: -1, Args: key}, backend.SCard},
+		{server.Command{Name: "SMEMBERS", Description: "Gets all the members in a set", Usage: "SMEMBERS key",
+			MinArgs: 1, MaxArgs: 1, Flags: server.FlagReadOnly, FirstKey: 1, Args: key}, mem.SMembers},
+		{server.Command{Name: "SDIFF", Description: "Subtracts multiple sets", Usage: "SDIFF key [key ...]",
+			MinArgs: 2, MaxArgs: server.Variadic, Flags: server.FlagReadOnly, FirstKey: 1, LastKey: -1, Args: key}, backend.SDiff},
+		{server.Command{Name: "SISMEMBER", Description: "Returns if member is a member of the set", Usage: "SISMEMBER key member [member ...]",
+			MinArgs: 2, MaxArgs: server.Variadic, Flags: server.FlagReadOnly, FirstKey: 1, Args: keyMember}, backend.SIsMember},
+		{server.Command{Name: "SINTER", Description: "Returns the members of the set resulting from the intersection of all the given sets", Usage: "SINTER key [key ...]",
+			MinArgs: 2, MaxArgs: server.Variadic, Flags: server.FlagReadOnly, FirstKey: 1, LastKey: -1, Args: key}, backend.SInter},
+		{server.Command{Name: "SUNION", Description: "Returns the members of the set resulting from the union of all the given sets", Usage: "SUNION key [key ...]",
+			MinArgs: 2, MaxArgs: server.Variadic, Flags: server.FlagReadOnly, FirstKey: 1, LastKey: -1, Args: key}, backend.SUnion},
+	}
+	for _, c := range commands {
+		if err := app.RegisterFunc(c.cmd, c.fn); err != nil {
+			return nil, err
 		}
-		client.Flush()
-		return nil
 	}
+	return backend, nil
 }
 
-func (stats *StatsBackend) SUnion(data interface{}, client server.ProtocolClient) error {
-	d, _ := data.([][]byte)
-	if len(d) < 2 {
-		client.WriteError(errors.New("SUNION takes at least 2 parameters (SINTER key [key ...])"))
-		client.Flush()
-		return nil
-	} else {
-		keys := make([]string, len(d))
-		for i, v := range d {
-			keys[i] = string(v)
-		}
-		results, err := stats.mem.SUnion(keys)
-		if err != nil {
-			return err
-		}
-
-		client.WriteLen('*', len(results))
-		for k, _ := range results {
-			client.WriteString(k)
-		}
-		client.Flush()
-		return nil
+// Info will report the number of counters, values and sets being tracked
+func (stats *StatsBackend) Info() (map[string]interface{}, error) {
+	counters, values, sets, err := stats.mem.Sizes()
+	if err != nil {
+		return nil, err
 	}
+	return map[string]interface{}{"Counters": counters, "Values": values, "Sets": sets}, nil
 }
 
-func RegisterBackend(app *server.BroadcastServer) (server.Backend, error) {
-	backend := new(StatsBackend)
-	mem, err := NewMemoryBackend()
+// CollectMetrics will export every counter (with its rate per second), value and set cardinality
+// being tracked, each as a single metric family with the key of every sample as its label (i.e.
+// broadcast_stats_counter{key="api.requests"})
+func (stats *StatsBackend) CollectMetrics(w *server.MetricsWriter) {
+	snapshot, err := stats.mem.Snapshot()
 	if err != nil {
-		return nil, err
+		return
 	}
 
-	backend.mem = mem
+	counters := make(map[string]float64, len(snapshot.Counters))
+	rates := make(map[string]float64, len(snapshot.Counters))
+	for key, counter := range snapshot.Counters {
+		counters[key] = float64(counter.Value)
+		rates[key] = counter.RatePerSecond
+	}
+	values := make(map[string]float64, len(snapshot.Values))
+	for key, value := range snapshot.Values {
+		values[key] = float64(value)
+	}
+	sets := make(map[string]float64, len(snapshot.Sets))
+	for key, n := range snapshot.Sets {
+		sets[key] = float64(n)
+	}
 
-	app.RegisterCommand(server.Command{"COUNT", "Increments a key that resets itself to 0 on each flush routine.", "COUNT foo [124]", true}, backend.Count)
-	app.RegisterCommand(server.Command{"COUNTERS", "Returns the list of active counters.", "", false}, backend.Counters)
-	app.RegisterCommand(server.Command{"INCR", "Increments a key by the specified value or by default 1.", "INCR key [1]", false}, backend.Incr)
-	app.RegisterCommand(server.Command{"DECR", "Decrements a key by the specified value or by default 1.", "DECR key [1]", false}, backend.Decr)
-	app.RegisterCommand(server.Command{"DEL", "Deletes a key from the values or counters list or both.", "DEL key", false}, backend.Del)
-	app.RegisterCommand(server.Command{"EXISTS", "Determines if the given key exists from the values.", "EXISTS key", false}, backend.Exists)
-	app.RegisterCommand(server.Command{"GET", "Gets the specified key from the values.", "GET key", false}, backend.Get)
-	app.RegisterCommand(server.Command{"SET", "Sets the specified key to the specified value in values.", "SET key 1234", false}, backend.Set)
-	app.RegisterCommand(server.Command{"SETNX", "Sets the specified key to the given value only if the key is not already set.", "SETNX key 1234", false}, backend.SetNx)
-	app.RegisterCommand(server.Command{"KEYS", "Returns the list of keys available or by pattern", "KEYS [pattern]", false}, backend.Keys)
-
-	// set commands
-	app.RegisterCommand(server.Command{"SADD", "Adds one or more members to a set", "SADD key member [member ...]", false}, backend.SAdd)
-	app.RegisterCommand(server.Command{"SREM", "Removes one or more members from a set", "SREM key member [member ...]", false}, backend.SRem)
-	app.RegisterCommand(server.Command{"SCARD", "Gets the number of members from a set", "SCARD key [key ...]", false}, backend.SCard)
-	app.RegisterCommand(server.Command{"SMEMBERS", "Gets all the members in a set", "SMEMBERS key", false}, backend.SMembers)
-	app.RegisterCommand(server.Command{"SDIFF", "Subtracts multiple sets", "SDIFF key [key ...]", false}, backend.SDiff)
-	app.RegisterCommand(server.Command{"SISMEMBER", "Returns if member is a member of the set", "SISMEMBER key member [member ...]", false}, backend.SIsMember)
-	app.RegisterCommand(server.Command{"SINTER", "Returns the members of the set resulting from the intersection of all the given sets", "SINTER key [key ...]", false}, backend.SInter)
-	app.RegisterCommand(server.Command{"SUNION", "Returns the members of the set resulting from the union of all the given sets", "SINTER key [key ...]", false}, backend.SUnion)
-	return backend, nil
+	w.GaugeVec("broadcast_stats_counter", "Value of each counter since the last flush", "key", counters)
+	w.GaugeVec("broadcast_stats_counter_rate_per_second", "Average rate per second of each counter", "key", rates)
+	w.GaugeVec("broadcast_stats_value", "Value of each key", "key", values)
+	w.GaugeVec("broadcast_stats_set_cardinality", "Number of members of each set", "key", sets)
 }
 
 func (stats *StatsBackend) Load() error {
@@ -0,0 +1,128 @@
+package stats
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nyxtom/broadcast/server"
+)
+
+// pipeListener hands the server end of pipe connections to the server as they are dialed
+type pipeListener struct {
+	conns chan net.Conn
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) { return <-l.conns, nil }
+func (l *pipeListener) Close() error              { return nil }
+func (l *pipeListener) Addr() net.Addr            { return &net.UnixAddr{Name: "pipe", Net: "unix"} }
+
+// dial will connect a new client to the server
+func (l *pipeListener) dial() *server.NetworkClient {
+	conn, peer := net.Pipe()
+	l.conns <- conn
+	client, _ := server.NewNetworkClient(peer)
+	return client
+}
+
+// newTestServer will create a server with the stats backend accepting pipe connections, the
+// server is left running as the process exits once the tests complete
+func newTestServer(t *testing.T) (*server.BroadcastServer, *pipeListener) {
+	app := server.NewBroadcastServer()
+	if _, err := RegisterBackend(app); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &pipeListener{make(chan net.Conn)}
+	if _, err := app.AddNetListener(l, server.NewDefaultBroadcastServerProtocol()); err != nil {
+		t.Fatal(err)
+	}
+	go app.AcceptConnections()
+	return app, l
+}
+
+// send will write the command as an array of bulk strings
+func send(client *server.NetworkClient, args ...string) {
+	b := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b = append(b, "$"+strconv.Itoa(len(arg))+"\r\n"+arg+"\r\n"...)
+	}
+	go client.Conn.Write(b)
+}
+
+// reply will read the next reply off of the connection
+func reply(t *testing.T, client *server.NetworkClient) interface{} {
+	t.Helper()
+	client.Conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	v, err := client.ReadInterface()
+	if err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	return v
+}
+
+func TestSetsOfMissingKeys(t *testing.T) {
+	_, l := newTestServer(t)
+	client := l.dial()
+	defer client.Close()
+
+	// the union of missing sets is empty rather than null
+	send(client, "SUNION", "missing", "other")
+	if v, ok := reply(t, client).([]interface{}); !ok || len(v) != 0 {
+		t.Fatalf("expected an empty array, got %#v", v)
+	}
+
+	send(client, "SADD", "a", "x", "y")
+	reply(t, client)
+	send(client, "SUNION", "a", "missing")
+	if v, ok := reply(t, client).([]interface{}); !ok || len(v) != 2 || v[0] != "x" || v[1] != "y" {
+		t.Fatalf("expected the members of the set, got %#v", v)
+	}
+
+	// any other set operation on a missing set is null
+	for _, cmd := range [][]string{{"SMEMBERS", "missing"}, {"SINTER", "a", "missing"}, {"SDIFF", "missing", "a"}} {
+		send(client, cmd...)
+		if v := reply(t, client); v != nil {
+			t.Fatalf("expected a null reply to %v, got %#v", cmd, v)
+		}
+	}
+}
+
+func TestCollectMetrics(t *testing.T) {
+	mem, err := NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := &StatsBackend{mem: mem}
+
+	// keys that are not valid metric names, or that would map to the same name, are labels
+	stats.Count("api.requests", 3)
+	stats.Count("api_requests")
+	stats.Incr("total", 42)
+	stats.SAdd("members", "a", "b")
+	stats.SAdd(`quote"d`, "c")
+
+	w := server.NewMetricsWriter()
+	stats.CollectMetrics(w)
+
+	expected := `# HELP broadcast_stats_counter Value of each counter since the last flush
+# TYPE broadcast_stats_counter gauge
+broadcast_stats_counter{key="api.requests"} 3
+broadcast_stats_counter{key="api_requests"} 1
+# HELP broadcast_stats_counter_rate_per_second Average rate per second of each counter
+# TYPE broadcast_stats_counter_rate_per_second gauge
+broadcast_stats_counter_rate_per_second{key="api.requests"} 0
+broadcast_stats_counter_rate_per_second{key="api_requests"} 0
+# HELP broadcast_stats_value Value of each key
+# TYPE broadcast_stats_value gauge
+broadcast_stats_value{key="total"} 42
+# HELP broadcast_stats_set_cardinality Number of members of each set
+# TYPE broadcast_stats_set_cardinality gauge
+broadcast_stats_set_cardinality{key="members"} 2
+broadcast_stats_set_cardinality{key="quote\"d"} 1
+`
+	if metrics := string(w.Bytes()); metrics != expected {
+		t.Fatalf("expected metrics:\n%s\ngot:\n%s", expected, metrics)
+	}
+}
@@ -2,6 +2,7 @@ package broadcast
 
 import (
 	"container/list"
+	"crypto/tls"
 	"net"
 	"strconv"
 	"sync"
@@ -22,27 +23,65 @@ type Client struct {
 	host        string
 	addr        string
 	maxIdle     int
-	serverAddr  *net.TCPAddr
+	dial        DialFunc
+	user        string
+	password    string
 	connections *list.List
 }
 
+// DialFunc is used to establish new network connections to the broadcast server
+type DialFunc func() (net.Conn, error)
+
 func NewClient(port int, host string, maxIdle int, bprotocol string) (*Client, error) {
-	client := new(Client)
-	client.protocol = "tcp"
-	client.bprotocol = bprotocol
-	client.port = port
-	client.host = host
-	client.addr = host + ":" + strconv.Itoa(port)
-	client.connections = list.New()
-	client.maxIdle = maxIdle
-	serverAddr, err := net.ResolveTCPAddr("tcp", client.addr)
+	return NewClientNetwork("tcp", host+":"+strconv.Itoa(port), maxIdle, bprotocol)
+}
+
+// NewClientNetwork will create a client that connects to the broadcast server on the given network and address
+func NewClientNetwork(network string, addr string, maxIdle int, bprotocol string) (*Client, error) {
+	client := NewClientDial(func() (net.Conn, error) {
+		return net.Dial(network, addr)
+	}, maxIdle, bprotocol)
+	client.protocol = network
+	client.addr = addr
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		client.host = host
+		client.port, _ = strconv.Atoi(port)
+	}
+	return client, nil
+}
+
+// NewClientTLS will create a client that connects to the broadcast server over tls, see NewTLSConfig
+func NewClientTLS(network string, addr string, config *tls.Config, maxIdle int, bprotocol string) (*Client, error) {
+	client, err := NewClientNetwork(network, addr, maxIdle, bprotocol)
 	if err != nil {
 		return nil, err
 	}
-	client.serverAddr = serverAddr
+
+	client.dial = func() (net.Conn, error) {
+		return tls.Dial(network, addr, config)
+	}
 	return client, nil
 }
 
+// NewClientDial will create a client that establishes its connections with the given dial function
+func NewClientDial(dial DialFunc, maxIdle int, bprotocol string) *Client {
+	client := new(Client)
+	client.bprotocol = bprotocol
+	client.dial = dial
+	client.connections = list.New()
+	client.maxIdle = maxIdle
+	return client
+}
+
+// SetAuth will authenticate every new connection with the given user and password,
+// an empty user will authenticate as the server's default user
+func (client *Client) SetAuth(user string, password string) {
+	client.Lock()
+	defer client.Unlock()
+	client.user = user
+	client.password = password
+}
+
 func (client *Client) Do(cmd string, args ...interface{}) (interface{}, error) {
 	c := client.get()
 	reply, err := c.Do(cmd, args...)
@@ -83,7 +122,9 @@ func (client *Client) get() *ClientConnection {
 		c.addr = client.addr
 		c.protocol = client.protocol
 		c.bprotocol = client.bprotocol
-		c.serverAddr = client.serverAddr
+		c.dial = client.dial
+		c.user = client.user
+		c.password = client.password
 		return c
 	} else {
 		e := client.connections.Front()
@@ -111,7 +152,9 @@ type ClientConnection struct {
 	bprotocol  string
 	addr       string
 	netClient  server.ProtocolClient
-	serverAddr *net.TCPAddr
+	dial       DialFunc
+	user       string
+	password   string
 	lastActive time.Time
 }
 
@@ -159,7 +202,7 @@ func (c *ClientConnection) connect() error {
 		return nil
 	}
 
-	conn, err := net.DialTCP(c.protocol, nil, c.serverAddr)
+	conn, err := c.dial()
 	if err != nil {
 		return err
 	}
@@ -169,10 +212,32 @@ func (c *ClientConnection) connect() error {
 		return err
 	}
 
+	return c.auth()
+}
+
+// auth will authenticate a newly established connection when credentials have been provided
+func (c *ClientConnection) auth() error {
+	if len(c.password) == 0 {
+		return nil
+	}
+
+	args := []interface{}{c.password}
+	if len(c.user) > 0 {
+		args = []interface{}{c.user, c.password}
+	}
+
+	reply, err := c.Do("AUTH", args...)
+	if err != nil {
+		return err
+	} else if err, ok := reply.(error); ok {
+		c.finalize()
+		return err
+	}
+
 	return nil
 }
 
-func (c *ClientConnection) newClient(conn *net.TCPConn) (server.ProtocolClient, error) {
+func (c *ClientConnection) newClient(conn net.Conn) (server.ProtocolClient, error) {
 	switch c.bprotocol {
 	case "redis":
 		return redisProtocol.NewRedisProtocolClient(conn)
@@ -0,0 +1,41 @@
+package broadcast
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+// NewTLSConfig will create the tls configuration used to connect to a tls enabled broadcast server.
+// The CA file verifies the server certificate (system roots are used when empty), the certificate
+// and key are presented to servers that require client certificates (mutual tls).
+func NewTLSConfig(caFile string, certFile string, keyFile string, serverName string, insecure bool) (*tls.Config, error) {
+	config := new(tls.Config)
+	config.ServerName = serverName
+	config.InsecureSkipVerify = insecure
+	config.MinVersion = tls.VersionTLS12
+
+	if len(caFile) > 0 {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA file " + caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"os"
@@ -12,24 +13,68 @@ import (
 	"github.com/nyxtom/broadcast/client/go/broadcast"
 )
 
-var helpCommands = [][]string{}
-var helpCommandsMap = make(map[string]int)
+// commandHelp is the help and metadata of a command as returned by the cmds command
+type commandHelp struct {
+	Name        string
+	Usage       string
+	Description string
+	FireForget  bool
+	MinArgs     int
+	MaxArgs     int
+	Flags       []string
+	Args        []string
+}
+
+var helpCommands = make(map[string]commandHelp)
 
 func main() {
 	var ip = flag.String("h", "127.0.0.1", "broadcast server ip (default 127.0.0.1)")
 	var port = flag.Int("p", 7331, "broadcast server port (default 7331)")
+	var socket = flag.String("s", "", "broadcast server unix socket path (overrides host and port)")
 	var maxIdle = flag.Int("i", 1, "max idle client connections to pool from")
 	var bprotocol = flag.String("bprotocol", "redis", "broadcast server protocol to follow")
+	var useTLS = flag.Bool("tls", false, "connect to the broadcast server over tls")
+	var caCert = flag.String("cacert", "", "CA certificate file to verify the server with (tls)")
+	var cert = flag.String("cert", "", "client certificate file to authenticate with (tls)")
+	var key = flag.String("key", "", "client private key file to authenticate with (tls)")
+	var sni = flag.String("sni", "", "server name used to verify the server certificate (tls)")
+	var insecure = flag.Bool("insecure", false, "skip verification of the server certificate (tls)")
+	var user = flag.String("user", "", "user to authenticate as")
+	var password = flag.String("a", "", "password to authenticate with")
 	var skipCmd = flag.Bool("skipcmds", false, "skip the initial cmds command if the server doesnt support it")
 
 	flag.Parse()
 
 	addr := *ip + ":" + strconv.Itoa(*port)
-	c, err := broadcast.NewClient(*port, *ip, *maxIdle, *bprotocol)
+	network := "tcp"
+	if len(*socket) > 0 {
+		addr = *socket
+		network = "unix"
+	}
+
+	var c *broadcast.Client
+	var config *tls.Config
+	var err error
+	if *useTLS {
+		serverName := *sni
+		if len(serverName) == 0 && network == "tcp" {
+			serverName = *ip
+		}
+
+		config, err = broadcast.NewTLSConfig(*caCert, *cert, *key, serverName, *insecure)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		c, err = broadcast.NewClientTLS(network, addr, config, *maxIdle, *bprotocol)
+	} else {
+		c, err = broadcast.NewClientNetwork(network, addr, *maxIdle, *bprotocol)
+	}
 	if err != nil {
 		fmt.Printf(err.Error())
 		os.Exit(1)
 	}
+	c.SetAuth(*user, *password)
 
 	// perform the initial cmds to see what is available
 	if !*skipCmd {
@@ -62,10 +107,14 @@ func main() {
 		} else {
 			addHistory(cmd)
 
+			cmd := strings.ToUpper(cmds[0])
+			help, known := helpCommands[cmd]
 			args := make([]interface{}, len(cmds[1:]))
 			for i := range args {
 				item := strings.Trim(string(cmds[1+i]), "\"'")
-				if a, err := strconv.Atoi(item); err == nil {
+				if t := help.argType(i); t == "key" || t == "string" {
+					args[i] = item
+				} else if a, err := strconv.Atoi(item); err == nil {
 					args[i] = a
 				} else if a, err := strconv.ParseFloat(item, 64); err == nil {
 					args[i] = a
@@ -79,12 +128,17 @@ func main() {
 				}
 			}
 
-			cmd := strings.ToUpper(cmds[0])
 			if strings.ToLower(cmd) == "help" || cmd == "?" {
 				printHelp(cmds)
 			} else if cmd == "CMDS" {
 				printCmds()
-			} else if cmd == "SUBSCRIBE" {
+			} else if known && !help.validArity(len(args)) {
+				fmt.Printf("(error) wrong number of arguments for '%s' command", cmd)
+				if len(help.Usage) > 0 {
+					fmt.Printf(" (usage: %s)", help.Usage)
+				}
+				fmt.Printf("\n")
+			} else if known && help.hasFlag("blocking") {
 				conn := c.Get()
 				conn.DoAsync(cmd, args...)
 				for {
@@ -96,8 +150,7 @@ func main() {
 					}
 				}
 			} else {
-				async := isCmdAsync(cmd)
-				if async {
+				if help.FireForget {
 					c.DoAsync(cmd, args...)
 				} else {
 					reply, err := c.Do(cmd, args...)
@@ -113,15 +166,64 @@ func main() {
 	}
 }
 
-func isCmdAsync(cmd string) bool {
-	for _, v := range helpCommands {
-		if v[0] == cmd && v[3] == "true" {
+// argType will return the declared type of the argument at the given index (empty if undeclared)
+func (help commandHelp) argType(i int) string {
+	if len(help.Args) == 0 {
+		return ""
+	} else if i >= len(help.Args) {
+		return help.Args[len(help.Args)-1]
+	}
+	return help.Args[i]
+}
+
+// declared will determine whether the command declares the arguments it accepts
+func (help commandHelp) declared() bool {
+	return help.MinArgs > 0 || help.MaxArgs != 0 || len(help.Flags) > 0 || len(help.Args) > 0
+}
+
+// validArity will determine whether the number of arguments is within the declared arity
+func (help commandHelp) validArity(n int) bool {
+	if !help.declared() {
+		return true
+	}
+	return n >= help.MinArgs && (help.MaxArgs < 0 || n <= help.MaxArgs)
+}
+
+// hasFlag will determine whether the command has the given flag (i.e. readonly, blocking)
+func (help commandHelp) hasFlag(flag string) bool {
+	for _, f := range help.Flags {
+		if f == flag {
 			return true
 		}
 	}
 	return false
 }
 
+// parseCommandHelp will read the help and metadata of a command from the cmds reply
+func parseCommandHelp(name string, cmd map[string]interface{}) commandHelp {
+	help := commandHelp{Name: name}
+	help.Description, _ = cmd["Description"].(string)
+	help.Usage, _ = cmd["Usage"].(string)
+	help.FireForget, _ = cmd["FireForget"].(bool)
+	if n, ok := cmd["MinArgs"].(float64); ok {
+		help.MinArgs = int(n)
+	}
+	if n, ok := cmd["MaxArgs"].(float64); ok {
+		help.MaxArgs = int(n)
+	}
+	if flags, ok := cmd["Flags"].([]interface{}); ok {
+		for _, f := range flags {
+			help.Flags = append(help.Flags, fmt.Sprintf("%v", f))
+		}
+	}
+	if args, ok := cmd["Args"].([]interface{}); ok {
+		for _, a := range args {
+			help.Args = append(help.Args, fmt.Sprintf("%v", a))
+		}
+	}
+	return help
+}
+
 func printReply(cmd string, reply interface{}, indent string) {
 	if strings.ToLower(cmd) == "cmds" {
 		r, ok := reply.(map[string]interface{})
@@ -129,21 +231,17 @@ func printReply(cmd string, reply interface{}, indent string) {
 			fmt.Printf("%s\n", string(reply.(error).Error()))
 			return
 		}
-		helpReply := false
-		if helpCommands == nil || len(helpCommands) == 0 {
-			helpReply = true
-			helpCommands = make([][]string, 0)
-		}
+		helpReply := len(helpCommands) == 0
 		for k, v := range r {
-			cmd := v.(map[string]interface{})
-			desc := cmd["Description"].(string)
-			usage := cmd["Usage"].(string)
-			async := fmt.Sprintf("%v", (cmd["FireForget"].(bool)))
+			cmd, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			help := parseCommandHelp(k, cmd)
 			if helpReply {
-				helpCommands = append(helpCommands, []string{k, usage, desc, async})
-				helpCommandsMap[k] = len(helpCommands) - 1
+				helpCommands[k] = help
 			} else {
-				printCommandHelp([]string{k, usage, desc, async})
+				printCommandHelp(help)
 			}
 		}
 		return
@@ -204,24 +302,26 @@ Type:   "help <command>" for help on <command>
 	fmt.Println(msg)
 }
 
-func printCommandHelp(arr []string) {
-	fmt.Printf("%s\n %s", arr[0], arr[2])
-	if len(arr[1]) > 0 {
-		fmt.Printf("\n usage: %s", arr[1])
+func printCommandHelp(help commandHelp) {
+	fmt.Printf("%s\n %s", help.Name, help.Description)
+	if len(help.Usage) > 0 {
+		fmt.Printf("\n usage: %s", help.Usage)
+	}
+	if len(help.Flags) > 0 {
+		fmt.Printf("\n flags: %s", strings.Join(help.Flags, ", "))
 	}
 	fmt.Printf("\n\n")
 }
 
 func printCmds() {
 	var cmds []string
-	for _, v := range helpCommands {
-		cmds = append(cmds, v[0])
+	for k := range helpCommands {
+		cmds = append(cmds, k)
 	}
 
 	sort.Strings(cmds)
 	for _, v := range cmds {
-		i := helpCommandsMap[v]
-		printCommandHelp(helpCommands[i])
+		printCommandHelp(helpCommands[v])
 	}
 }
 
@@ -232,20 +332,17 @@ func printHelp(cmds []string) {
 	} else if len(args) > 1 {
 		fmt.Println()
 	} else {
-		cmd := strings.ToUpper(args[0])
-		for i := 0; i < len(helpCommands); i++ {
-			if helpCommands[i][0] == cmd {
-				printCommandHelp(helpCommands[i])
-			}
+		if help, ok := helpCommands[strings.ToUpper(args[0])]; ok {
+			printCommandHelp(help)
 		}
 	}
 }
 
 func completionHandler(in string) []string {
 	var keywords []string
-	for _, i := range helpCommands {
-		if strings.HasPrefix(i[0], strings.ToUpper(in)) {
-			keywords = append(keywords, i[0])
+	for k := range helpCommands {
+		if strings.HasPrefix(k, strings.ToUpper(in)) {
+			keywords = append(keywords, k)
 		}
 	}
 	return keywords
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/signal"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,23 +21,85 @@ import (
 	"github.com/nyxtom/broadcast/backends/bdefault"
 	"github.com/nyxtom/broadcast/backends/pubsub"
 	"github.com/nyxtom/broadcast/backends/stats"
+	"github.com/nyxtom/broadcast/protocols/auto"
+	"github.com/nyxtom/broadcast/protocols/http"
 	"github.com/nyxtom/broadcast/protocols/line"
 	"github.com/nyxtom/broadcast/protocols/redis"
 	"github.com/nyxtom/broadcast/server"
 )
 
 type Configuration struct {
-	port            int           // port of the server
-	host            string        // host of the server
-	bprotocol       string        // broadcast protocol configuration
-	backend_default BackendConfig // bdefault backend configuration
-	backend_stats   BackendConfig // stats backend configuration
-	backend_pubsub  BackendConfig // pubsub backend configuration
-	backend_bgraph  BackendConfig // bgraph backend configuration
+	Port           int               `toml:"port"`              // port of the server
+	Host           string            `toml:"host"`              // host of the server
+	BProtocol      string            `toml:"bprotocol"`         // broadcast protocol configuration
+	UnixSocket     string            `toml:"unixsocket"`        // unix socket path to listen on
+	UnixSocketPerm string            `toml:"unixsocketperm"`    // unix socket file mode (i.e. 0770)
+	Listeners      []ListenerConfig  `toml:"listener"`          // listeners to bind, overrides host/port/bprotocol
+	Users          []UserConfig      `toml:"user"`              // users clients can authenticate as
+	RateLimits     []RateLimitConfig `toml:"ratelimit"`         // rate limits of commands and categories
+	Timeout        string            `toml:"timeout"`           // default deadline of every command (i.e. 5s)
+	Timeouts       map[string]string `toml:"timeouts"`          // deadlines of individual commands
+	Drain          string            `toml:"drain"`             // drain period of a graceful shutdown (i.e. 10s)
+	MaxClients     int               `toml:"maxclients"`        // maximum number of connected clients (0 for no limit)
+	MaxClientsIP   int               `toml:"maxclients_ip"`     // maximum number of clients per source address (0 for no limit)
+	AcceptRate     float64           `toml:"accept_rate"`       // maximum connections accepted per second (0 for no limit)
+	AcceptBurst    int               `toml:"accept_burst"`      // connections accepted at once above the accept rate
+	IdleTimeout    string            `toml:"idle_timeout"`      // close clients idle for this long, subscribers are exempt (i.e. 5m)
+	KeepAlive      string            `toml:"keepalive"`         // tcp keepalive period (i.e. 30s, -1s to disable)
+	NoDelay        bool              `toml:"nodelay"`           // disable nagle's algorithm on tcp connections
+	Heartbeat      string            `toml:"heartbeat"`         // interval of heartbeats sent to subscribers (i.e. 30s)
+	MaxBulkLen     int64             `toml:"max_bulk_len"`      // maximum length of a bulk payload in bytes
+	MaxArrayLen    int64             `toml:"max_array_len"`     // maximum number of elements of a request array
+	MaxDepth       int               `toml:"max_depth"`         // maximum nesting depth of request arrays
+	MaxLineLen     int               `toml:"max_line_len"`      // maximum length of a request line in bytes
+	LogLevel       string            `toml:"log_level"`         // minimum level logged (debug, info, warn, error, fatal)
+	LogFormat      string            `toml:"log_format"`        // format of the log (text or json)
+	LogFile        string            `toml:"log_file"`          // file to log to instead of stdout, rotated by size
+	LogMaxSize     int64             `toml:"log_max_size"`      // size in megabytes the log file is rotated at
+	LogBackups     int               `toml:"log_backups"`       // number of rotated log files to keep
+	SlowThreshold  string            `toml:"slowlog_threshold"` // commands running at least this long are recorded in the slow log (i.e. 10ms, -1s to disable)
+	SlowLogMaxLen  int               `toml:"slowlog_max_len"`   // number of entries kept in the slow log
+	Metrics        string            `toml:"metrics"`           // address to serve prometheus metrics on over http (i.e. 127.0.0.1:9331)
+	BackendDefault BackendConfig     `toml:"backend_default"`   // bdefault backend configuration
+	BackendStats   BackendConfig     `toml:"backend_stats"`     // stats backend configuration
+	BackendPubsub  BackendConfig     `toml:"backend_pubsub"`    // pubsub backend configuration
+	BackendBgraph  BackendConfig     `toml:"backend_bgraph"`    // bgraph backend configuration
+}
+
+type ListenerConfig struct {
+	Network  string `toml:"network"`  // network of the listener (tcp or unix)
+	Host     string `toml:"host"`     // host of the listener
+	Port     int    `toml:"port"`     // port of the listener
+	Path     string `toml:"path"`     // socket path of a unix listener
+	Mode     string `toml:"mode"`     // socket file mode of a unix listener (i.e. 0770)
+	Protocol string `toml:"protocol"` // broadcast protocol of the listener
+
+	TLSCert              string `toml:"tls_cert"`                // certificate file to serve tls with
+	TLSKey               string `toml:"tls_key"`                 // private key file to serve tls with
+	TLSClientCA          string `toml:"tls_client_ca"`           // CA file to verify client certificates with
+	TLSRequireClientCert bool   `toml:"tls_require_client_cert"` // require verified client certificates
+
+	IdleTimeout string `toml:"idle_timeout"` // overrides the server idle timeout for this listener
+	KeepAlive   string `toml:"keepalive"`    // overrides the server tcp keepalive period for this listener
+	NoDelay     *bool  `toml:"nodelay"`      // overrides the server no-delay setting for this listener
+	Heartbeat   string `toml:"heartbeat"`    // overrides the server heartbeat interval for this listener
+}
+
+type UserConfig struct {
+	Name     string   `toml:"name"`     // name of the user
+	Password string   `toml:"password"` // password in plain text or as sha256:<hex digest>
+	Commands []string `toml:"commands"` // command rules (i.e. +@read, -DEL, +S*)
+}
+
+type RateLimitConfig struct {
+	Command string  `toml:"command"` // command or @category the limit applies to
+	Rate    float64 `toml:"rate"`    // commands permitted per second
+	Burst   int     `toml:"burst"`   // commands permitted at once above the rate
+	Per     string  `toml:"per"`     // scope of the limit (connection or identity)
 }
 
 type BackendConfig struct {
-	enabled bool // enabled setting for backend config
+	Enabled bool `toml:"enabled"` // enabled setting for backend config
 }
 
 func main() {
@@ -48,12 +114,77 @@ func main() {
 	var backend_stats = flag.Bool("backend_stats", false, "Broadcast stats backend enabled setting")
 	var backend_pubsub = flag.Bool("backend_pubsub", false, "Broadcast pubsub backend enabled setting")
 	var backend_bgraph = flag.Bool("backend_bgraph", false, "Broadcast graph backend enabled setting")
+	var unixSocket = flag.String("unixsocket", "", "Broadcast server unix socket path to listen on")
+	var unixSocketPerm = flag.String("unixsocketperm", "", "Broadcast server unix socket file mode (i.e. 0770)")
+	var timeout = flag.String("timeout", "", "Broadcast server default command deadline (i.e. 5s)")
+	var drainPeriod = flag.String("drain", "10s", "Broadcast server drain period for in-flight commands on SIGTERM")
+	var maxClients = flag.Int("maxclients", 0, "Broadcast server maximum number of connected clients (0 for no limit)")
+	var maxClientsIP = flag.Int("maxclients_ip", 0, "Broadcast server maximum number of clients per source address (0 for no limit)")
+	var acceptRate = flag.Float64("accept_rate", 0, "Broadcast server maximum connections accepted per second (0 for no limit)")
+	var acceptBurst = flag.Int("accept_burst", 10, "Broadcast server connections accepted at once above the accept rate")
+	var idleTimeout = flag.String("idle_timeout", "", "Broadcast server read idle timeout of clients, subscribers are exempt (i.e. 5m)")
+	var keepAlive = flag.String("keepalive", "", "Broadcast server tcp keepalive period (i.e. 30s, -1s to disable)")
+	var noDelay = flag.Bool("nodelay", true, "Broadcast server disables nagle's algorithm on tcp connections")
+	var heartbeat = flag.String("heartbeat", "", "Broadcast server interval of heartbeats sent to subscribers (i.e. 30s)")
+	var limits = server.DefaultProtocolLimits()
+	var maxBulkLen = flag.Int64("max_bulk_len", limits.MaxBulkLength, "Broadcast server maximum length of a bulk payload in bytes (0 for no limit)")
+	var maxArrayLen = flag.Int64("max_array_len", limits.MaxArrayLength, "Broadcast server maximum number of elements of a request array (0 for no limit)")
+	var maxDepth = flag.Int("max_depth", limits.MaxDepth, "Broadcast server maximum nesting depth of request arrays (0 for no limit)")
+	var maxLineLen = flag.Int("max_line_len", limits.MaxLineLength, "Broadcast server maximum length of a request line in bytes (0 for no limit)")
+	var logLevel = flag.String("loglevel", "info", "Broadcast server minimum log level (debug, info, warn, error, fatal)")
+	var logFormat = flag.String("logformat", "text", "Broadcast server log format (text or json)")
+	var logFile = flag.String("logfile", "", "Broadcast server log file, rotated by size (logs to stdout when empty)")
+	var logMaxSize = flag.Int64("logmaxsize", 100, "Broadcast server log file size in megabytes to rotate at")
+	var logBackups = flag.Int("logbackups", 5, "Broadcast server number of rotated log files to keep")
+	var slowLogThreshold = flag.String("slowlog_threshold", "10ms", "Broadcast server time commands must run for to be recorded in the slow log (-1s to disable)")
+	var slowLogMaxLen = flag.Int("slowlog_max_len", 128, "Broadcast server number of entries kept in the slow log")
+	var metrics = flag.String("metrics", "", "Broadcast server address to serve prometheus metrics on at /metrics (i.e. 127.0.0.1:9331)")
+	var listeners = flag.String("listeners", "", "Comma separated list of protocol://host:port or protocol:///socket/path listeners (i.e. redis://127.0.0.1:7331,line:///tmp/broadcast.sock)")
 	var configFile = flag.String("config", "", "Broadcast server configuration file (/etc/broadcast.conf)")
 	var cpuProfile = flag.String("cpuprofile", "", "write cpu profile to file")
 
 	flag.Parse()
 
-	cfg := &Configuration{*port, *host, *bprotocol, BackendConfig{*backend_default}, BackendConfig{*backend_stats}, BackendConfig{*backend_pubsub}, BackendConfig{*backend_bgraph}}
+	listenerCfgs, err := parseListeners(*listeners)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	cfg := &Configuration{
+		Port:           *port,
+		Host:           *host,
+		BProtocol:      *bprotocol,
+		UnixSocket:     *unixSocket,
+		UnixSocketPerm: *unixSocketPerm,
+		Listeners:      listenerCfgs,
+		Timeout:        *timeout,
+		Drain:          *drainPeriod,
+		MaxClients:     *maxClients,
+		MaxClientsIP:   *maxClientsIP,
+		AcceptRate:     *acceptRate,
+		AcceptBurst:    *acceptBurst,
+		IdleTimeout:    *idleTimeout,
+		KeepAlive:      *keepAlive,
+		NoDelay:        *noDelay,
+		Heartbeat:      *heartbeat,
+		MaxBulkLen:     *maxBulkLen,
+		MaxArrayLen:    *maxArrayLen,
+		MaxDepth:       *maxDepth,
+		MaxLineLen:     *maxLineLen,
+		LogLevel:       *logLevel,
+		LogFormat:      *logFormat,
+		LogFile:        *logFile,
+		LogMaxSize:     *logMaxSize,
+		LogBackups:     *logBackups,
+		SlowThreshold:  *slowLogThreshold,
+		SlowLogMaxLen:  *slowLogMaxLen,
+		Metrics:        *metrics,
+		BackendDefault: BackendConfig{Enabled: *backend_default},
+		BackendStats:   BackendConfig{Enabled: *backend_stats},
+		BackendPubsub:  BackendConfig{Enabled: *backend_pubsub},
+		BackendBgraph:  BackendConfig{Enabled: *backend_bgraph},
+	}
 	if len(*configFile) == 0 {
 		fmt.Printf("[%d] %s # WARNING: no config file specified, using the default config\n", os.Getpid(), time.Now().Format(time.RFC822))
 	} else {
@@ -69,17 +200,14 @@ func main() {
 		}
 	}
 
-	// locate the protocol specified (if there is one)
-	var serverProtocol server.BroadcastServerProtocol
-	if cfg.bprotocol == "" {
-		serverProtocol = server.NewDefaultBroadcastServerProtocol()
-	} else if cfg.bprotocol == "redis" {
-		serverProtocol = redisProtocol.NewRedisProtocol()
-	} else if cfg.bprotocol == "line" {
-		serverProtocol = lineProtocol.NewLineProtocol()
-	} else {
-		fmt.Println(errors.New("Invalid protocol " + cfg.bprotocol + " specified"))
-		return
+	// fallback to a single listener on the host/port/protocol specified
+	if len(cfg.Listeners) == 0 {
+		cfg.Listeners = []ListenerConfig{ListenerConfig{Host: cfg.Host, Port: cfg.Port, Protocol: cfg.BProtocol}}
+	}
+
+	// listen on the unix socket in addition to any other listeners
+	if len(cfg.UnixSocket) > 0 {
+		cfg.Listeners = append(cfg.Listeners, ListenerConfig{Network: "unix", Path: cfg.UnixSocket, Mode: cfg.UnixSocketPerm, Protocol: cfg.BProtocol})
 	}
 
 	if *cpuProfile != "" {
@@ -91,15 +219,95 @@ func main() {
 		pprof.StartCPUProfile(f)
 	}
 
-	// create a new broadcast server
-	app, err := server.ListenProtocol(cfg.port, cfg.host, serverProtocol)
+	// create a new broadcast server with all the configured listeners
+	app := server.NewBroadcastServer()
+	err = app.Log.Configure(cfg.LogLevel, cfg.LogFormat, cfg.LogFile, cfg.LogMaxSize*1024*1024, cfg.LogBackups)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
+	for _, l := range cfg.Listeners {
+		serverProtocol, err := newProtocol(l.Protocol)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		options, err := listenerOptions(cfg, l)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		err = addListener(app, l, serverProtocol, options)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	// users that clients are required to authenticate as
+	for _, u := range cfg.Users {
+		app.AddUser(&server.User{Name: u.Name, Password: u.Password, Commands: u.Commands})
+	}
+
+	drain, err := time.ParseDuration(cfg.Drain)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// size limits of requests
+	app.SetProtocolLimits(server.ProtocolLimits{
+		MaxBulkLength:  cfg.MaxBulkLen,
+		MaxArrayLength: cfg.MaxArrayLen,
+		MaxDepth:       cfg.MaxDepth,
+		MaxLineLength:  cfg.MaxLineLen,
+	})
+
+	// commands recorded in the slow log
+	slowThreshold, err := time.ParseDuration(cfg.SlowThreshold)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	app.SetSlowLog(slowThreshold, cfg.SlowLogMaxLen)
+
+	// rate limits of commands and categories
+	for _, r := range cfg.RateLimits {
+		if r.Per != "" && r.Per != "connection" && r.Per != "identity" {
+			fmt.Println("Invalid rate limit scope " + r.Per + " specified, expected connection or identity")
+			return
+		}
+		app.SetRateLimit(r.Command, server.RateLimit{Rate: r.Rate, Burst: r.Burst, PerIdentity: r.Per == "identity"})
+	}
+
+	// connection limits
+	app.SetMaxClients(cfg.MaxClients)
+	app.SetMaxClientsPerIP(cfg.MaxClientsIP)
+	app.SetAcceptRate(cfg.AcceptRate, cfg.AcceptBurst)
+
+	// command deadlines
+	if len(cfg.Timeout) > 0 {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		app.SetCommandTimeout("", d)
+	}
+	for cmd, t := range cfg.Timeouts {
+		d, err := time.ParseDuration(t)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		app.SetCommandTimeout(cmd, d)
+	}
+
 	// load the default backend should it be enabled
-	if cfg.backend_default.enabled {
+	if cfg.BackendDefault.Enabled {
 		backend, err := bdefault.RegisterBackend(app)
 		if err != nil {
 			fmt.Println(err)
@@ -109,7 +317,7 @@ func main() {
 	}
 
 	// load the stats backend should it be enabled
-	if cfg.backend_stats.enabled {
+	if cfg.BackendStats.Enabled {
 		backend, err := stats.RegisterBackend(app)
 		if err != nil {
 			fmt.Println(err)
@@ -119,7 +327,7 @@ func main() {
 	}
 
 	// load the pubsub backend should it be enabled
-	if cfg.backend_pubsub.enabled {
+	if cfg.BackendPubsub.Enabled {
 		backend, err := pubsub.RegisterBackend(app)
 		if err != nil {
 			fmt.Println(err)
@@ -129,7 +337,7 @@ func main() {
 	}
 
 	// load the bgraph backend should it be enabled
-	if cfg.backend_bgraph.enabled {
+	if cfg.BackendBgraph.Enabled {
 		backend, err := bgraph.RegisterBackend(app)
 		if err != nil {
 			fmt.Println(err)
@@ -138,27 +346,18 @@ func main() {
 		app.LoadBackend(backend)
 	}
 
-	// wait for all events to fire so we can log them
-	pid := os.Getpid()
-	go func() {
-		for !app.Closed {
-			event := <-app.Events
-			t := time.Now()
-			delim := "#"
-			if event.Level == "error" {
-				delim = "ERROR:"
-			}
-			msg := fmt.Sprintf("[%d] %s %s %s", pid, t.Format(time.RFC822), delim, event.Message)
-			if event.Err != nil {
-				msg += fmt.Sprintf(" %v", event.Err)
-			}
-
-			fmt.Println(msg)
+	// prometheus metrics of the server and backends
+	if len(cfg.Metrics) > 0 {
+		err = app.ListenMetrics(cfg.Metrics)
+		if err != nil {
+			fmt.Println(err)
+			return
 		}
-	}()
+	}
 
 	go func() {
 		<-app.Quit
+		app.Log.Close()
 		pprof.StopCPUProfile()
 		os.Exit(0)
 	}()
@@ -173,10 +372,155 @@ func main() {
 		os.Interrupt)
 
 	go func() {
-		<-sc
-		app.Close()
+		sig := <-sc
+		if sig == syscall.SIGTERM {
+			app.Shutdown(drain)
+		} else {
+			app.Close()
+		}
 	}()
 
 	// accept incomming connections!
 	app.AcceptConnections()
 }
+
+// newProtocol will locate the broadcast protocol by the given name
+func newProtocol(name string) (server.BroadcastServerProtocol, error) {
+	switch name {
+	case "", "interface":
+		return server.NewDefaultBroadcastServerProtocol(), nil
+	case "redis":
+		return redisProtocol.NewRedisProtocol(), nil
+	case "line":
+		return lineProtocol.NewLineProtocol(), nil
+	case "auto":
+		return autoProtocol.NewAutoProtocol(), nil
+	case "http":
+		return httpProtocol.NewHTTPProtocol(), nil
+	}
+
+	return nil, errors.New("Invalid protocol " + name + " specified")
+}
+
+// addListener will bind the configured tcp, tls or unix listener to the broadcast server
+func addListener(app *server.BroadcastServer, l ListenerConfig, protocol server.BroadcastServerProtocol, options server.ListenerOptions) error {
+	// tls settings apply to tcp and unix listeners alike and are never silently ignored
+	var config *tls.Config
+	if len(l.TLSCert) > 0 {
+		var err error
+		config, err = server.NewTLSConfig(l.TLSCert, l.TLSKey, l.TLSClientCA, l.TLSRequireClientCert)
+		if err != nil {
+			return err
+		}
+	} else if len(l.TLSKey) > 0 || len(l.TLSClientCA) > 0 || l.TLSRequireClientCert {
+		return errors.New("Invalid listener tls settings specified, tls_key, tls_client_ca and tls_require_client_cert require tls_cert")
+	}
+
+	var listener *server.BroadcastListener
+	var err error
+	if l.Network == "unix" {
+		var mode os.FileMode
+		if mode, err = parseMode(l.Mode); err != nil {
+			return err
+		} else if config != nil {
+			listener, err = app.AddUnixTLSListener(l.Path, mode, config, protocol)
+		} else {
+			listener, err = app.AddUnixListener(l.Path, mode, protocol)
+		}
+	} else if config != nil {
+		listener, err = app.AddTLSListener(l.Port, l.Host, config, protocol)
+	} else {
+		listener, err = app.AddListener(l.Port, l.Host, protocol)
+	}
+	if err != nil {
+		return err
+	}
+
+	listener.SetOptions(options)
+	return nil
+}
+
+// listenerOptions will build the connection settings of the listener from the server settings
+// and any overrides of the listener itself
+func listenerOptions(cfg *Configuration, l ListenerConfig) (server.ListenerOptions, error) {
+	options := server.DefaultListenerOptions()
+	options.NoDelay = cfg.NoDelay
+	if l.NoDelay != nil {
+		options.NoDelay = *l.NoDelay
+	}
+
+	settings := []struct {
+		value    *time.Duration
+		server   string
+		listener string
+	}{
+		{&options.IdleTimeout, cfg.IdleTimeout, l.IdleTimeout},
+		{&options.KeepAlive, cfg.KeepAlive, l.KeepAlive},
+		{&options.Heartbeat, cfg.Heartbeat, l.Heartbeat},
+	}
+	for _, setting := range settings {
+		s := setting.server
+		if len(setting.listener) > 0 {
+			s = setting.listener
+		}
+		if len(s) == 0 {
+			continue
+		}
+
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return options, err
+		}
+		*setting.value = d
+	}
+
+	return options, nil
+}
+
+// parseListeners will parse a comma separated list of protocol://host:port or protocol:///socket/path listeners
+func parseListeners(s string) ([]ListenerConfig, error) {
+	listeners := make([]ListenerConfig, 0)
+	if len(s) == 0 {
+		return listeners, nil
+	}
+
+	for _, v := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(v), "://", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid listener " + v + " specified, expected protocol://host:port")
+		}
+
+		if strings.HasPrefix(parts[1], "/") {
+			listeners = append(listeners, ListenerConfig{Network: "unix", Path: parts[1], Protocol: parts[0]})
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, err
+		}
+
+		listeners = append(listeners, ListenerConfig{Host: host, Port: p, Protocol: parts[0]})
+	}
+
+	return listeners, nil
+}
+
+// parseMode will parse an octal file mode (i.e. 0770), an empty mode leaves the default umask
+func parseMode(s string) (os.FileMode, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, errors.New("Invalid socket mode " + s + " specified")
+	}
+
+	return os.FileMode(mode), nil
+}
@@ -41,6 +41,9 @@ func main() {
 	var host = flag.String("h", "127.0.0.1", "Broadcast stats host to bind to")
 	var port = flag.Int("p", 7331, "Broadcast stats port to bind to")
 	var configFile = flag.String("config", "", "Broadcast stats configuration file (/etc/broadcast.conf)")
+	var logLevel = flag.String("loglevel", "info", "Broadcast stats minimum log level (debug, info, warn, error, fatal)")
+	var logFormat = flag.String("logformat", "text", "Broadcast stats log format (text or json)")
+	var logFile = flag.String("logfile", "", "Broadcast stats log file, rotated every 100mb (logs to stdout when empty)")
 	var cpuProfile = flag.String("cpuprofile", "", "write cpu profile to file")
 
 	flag.Parse()
@@ -81,6 +84,12 @@ func main() {
 		return
 	}
 
+	err = app.Log.Configure(*logLevel, *logFormat, *logFile, 100*1024*1024, 5)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	// setup stats backend
 	backend, err := stats.RegisterBackend(app)
 	if err != nil {
@@ -105,27 +114,9 @@ func main() {
 	}
 	app.LoadBackend(backend)
 
-	// wait for all events to fire so we can log them
-	pid := os.Getpid()
-	go func() {
-		for !app.Closed {
-			event := <-app.Events
-			t := time.Now()
-			delim := "#"
-			if event.Level == "error" {
-				delim = "ERROR:"
-			}
-			msg := fmt.Sprintf("[%d] %s %s %s", pid, t.Format(time.RFC822), delim, event.Message)
-			if event.Err != nil {
-				msg += fmt.Sprintf(" %v", event.Err)
-			}
-
-			fmt.Println(msg)
-		}
-	}()
-
 	go func() {
 		<-app.Quit
+		app.Log.Close()
 		pprof.StopCPUProfile()
 		os.Exit(0)
 	}()
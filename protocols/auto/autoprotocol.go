@@ -0,0 +1,164 @@
+package autoProtocol
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nyxtom/broadcast/protocols/line"
+	"github.com/nyxtom/broadcast/protocols/redis"
+	"github.com/nyxtom/broadcast/server"
+)
+
+// AutoProtocol is a broadcast protocol that will sniff the first bytes sent by a new connection
+// in order to determine which of the redis, interface or line protocols should handle it. This
+// allows clients of any of the protocols to connect to the same listener.
+//
+// Requests that start with an array made up of only bulk payloads (i.e. *1\r\n$4\r\nPING\r\n) are
+// valid under both the redis and interface protocols and will be handled by the redis protocol.
+type AutoProtocol struct {
+	sync.Mutex
+
+	ctx           *server.BroadcastContext
+	redis         server.BroadcastServerProtocol
+	line          server.BroadcastServerProtocol
+	iface         server.BroadcastServerProtocol
+	clients       map[server.ProtocolClient]server.BroadcastServerProtocol
+	DetectTimeout time.Duration // time to wait for the first bytes of a connection
+}
+
+func NewAutoProtocol() *AutoProtocol {
+	return NewAutoProtocolWith(redisProtocol.NewRedisProtocol(), lineProtocol.NewLineProtocol(), server.NewDefaultBroadcastServerProtocol())
+}
+
+// NewAutoProtocolWith will create an auto detecting protocol that hands connections off to the given protocols
+func NewAutoProtocolWith(redis, line, iface server.BroadcastServerProtocol) *AutoProtocol {
+	p := new(AutoProtocol)
+	p.redis = redis
+	p.line = line
+	p.iface = iface
+	p.clients = make(map[server.ProtocolClient]server.BroadcastServerProtocol)
+	p.DetectTimeout = 10 * time.Second
+	return p
+}
+
+func (p *AutoProtocol) Initialize(ctx *server.BroadcastContext) error {
+	p.ctx = ctx
+	for _, protocol := range []server.BroadcastServerProtocol{p.redis, p.line, p.iface} {
+		if err := protocol.Initialize(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *AutoProtocol) Name() string {
+	return "auto"
+}
+
+// HandleConnection will peek at the first bytes of the connection and hand the connection to the
+// detected protocol so that it can create the appropriate client. Peeked bytes are buffered and
+// replayed to the detected protocol's client as it reads from the connection.
+func (p *AutoProtocol) HandleConnection(conn net.Conn) (server.ProtocolClient, error) {
+	sniffed := newSniffedConn(conn)
+	conn.SetReadDeadline(time.Now().Add(p.DetectTimeout))
+	b, err := sniffed.peek()
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := p.detect(b)
+	client, err := protocol.HandleConnection(sniffed)
+	if err != nil {
+		return nil, err
+	}
+
+	client.SetProtocol(protocol.Name())
+	p.Lock()
+	p.clients[client] = protocol
+	p.Unlock()
+	return client, nil
+}
+
+// RunClient will run the client with the protocol that was detected when the connection was handled
+func (p *AutoProtocol) RunClient(client server.ProtocolClient) {
+	p.Lock()
+	protocol, ok := p.clients[client]
+	delete(p.clients, client)
+	p.Unlock()
+
+	if !ok {
+		client.WriteError(errInvalidProtocol)
+		client.Flush()
+		client.Close()
+		return
+	}
+
+	protocol.RunClient(client)
+}
+
+// detect will determine the protocol to use based on the first bytes sent by the client
+func (p *AutoProtocol) detect(b []byte) server.BroadcastServerProtocol {
+	if len(b) == 0 {
+		return p.line
+	}
+
+	switch b[0] {
+	case '*':
+		if isBulkArray(b) {
+			return p.redis
+		}
+		return p.iface
+	case '$', '+', ':', '.', '?', '&', '-', '~':
+		return p.iface
+	}
+
+	return p.line
+}
+
+// isBulkArray will determine whether the peeked array request is made up of only bulk payloads
+// (as is the case with the redis protocol), any other typed marker is an interface request
+func isBulkArray(b []byte) bool {
+	line, rest, ok := cutLine(b)
+	if !ok {
+		return true
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil {
+		return true
+	}
+
+	for i := 0; i < n; i++ {
+		line, rest, ok = cutLine(rest)
+		if !ok || len(line) == 0 {
+			return true
+		} else if line[0] != '$' {
+			return false
+		}
+
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return true
+		} else if size < 0 {
+			continue
+		} else if len(rest) < size+len(lineDelims) {
+			return true
+		}
+		rest = rest[size+len(lineDelims):]
+	}
+
+	return true
+}
+
+// cutLine will split the buffer on the first line delimiter
+func cutLine(b []byte) ([]byte, []byte, bool) {
+	i := bytes.Index(b, lineDelims)
+	if i < 0 {
+		return nil, nil, false
+	}
+	return b[:i], b[i+len(lineDelims):], true
+}
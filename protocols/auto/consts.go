@@ -0,0 +1,7 @@
+package autoProtocol
+
+import "errors"
+
+var errInvalidProtocol = errors.New("invalid protocol")
+var peekSize = 512
+var lineDelims = []byte("\r\n")
@@ -0,0 +1,42 @@
+package autoProtocol
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+)
+
+// sniffedConn is a network connection whose first bytes have been read ahead for protocol
+// detection, reads are served from the buffered data before reading from the connection itself
+type sniffedConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+}
+
+func newSniffedConn(conn net.Conn) *sniffedConn {
+	c := new(sniffedConn)
+	c.Conn = conn
+	c.reader = bufio.NewReaderSize(conn, peekSize)
+	return c
+}
+
+// peek will wait for the first bytes sent on the connection and return everything buffered so far
+func (c *sniffedConn) peek() ([]byte, error) {
+	if _, err := c.reader.Peek(1); err != nil {
+		return nil, err
+	}
+	return c.reader.Peek(c.reader.Buffered())
+}
+
+func (c *sniffedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// ConnectionState will return the tls state of the underlying connection (if it is a tls connection)
+func (c *sniffedConn) ConnectionState() tls.ConnectionState {
+	if conn, ok := c.Conn.(*tls.Conn); ok {
+		return conn.ConnectionState()
+	}
+	return tls.ConnectionState{}
+}
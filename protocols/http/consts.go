@@ -0,0 +1,20 @@
+package httpProtocol
+
+import (
+	"errors"
+	"time"
+)
+
+var errInvalidProtocol = errors.New("invalid protocol")
+var errNotFound = errors.New("not found, expected /cmd/<command>")
+var errMethodNotAllowed = errors.New("method not allowed, expected GET or POST")
+var errArgsFormat = errors.New("request body must be a json array of arguments")
+var errBodyTooLarge = errors.New("request body too large")
+var errHeaderTooLarge = errors.New("request headers too large")
+var errInternal = errors.New("internal error")
+var cmdPath = "/cmd/"
+var lineDelims = []byte("\r\n")
+
+// rejectTimeout is how long a connection rejected by admission control is given to send its
+// request and receive the response
+const rejectTimeout = time.Second
@@ -0,0 +1,325 @@
+package httpProtocol
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nyxtom/broadcast/server"
+)
+
+// HTTPProtocol is a gateway for http tooling, commands are sent as POST /cmd/INCR with a json array
+// of arguments (i.e. ["foo", 1]) or GET /cmd/GET?args=foo and replies are written as json
+// ({"result": ...} or {"error": "..."}) with errors mapped to http status codes
+type HTTPProtocol struct {
+	ctx *server.BroadcastContext
+}
+
+func NewHTTPProtocol() *HTTPProtocol {
+	return new(HTTPProtocol)
+}
+
+func (p *HTTPProtocol) Initialize(ctx *server.BroadcastContext) error {
+	p.ctx = ctx
+	return nil
+}
+
+func (p *HTTPProtocol) Name() string {
+	return "http"
+}
+
+func (p *HTTPProtocol) HandleConnection(conn net.Conn) (server.ProtocolClient, error) {
+	return NewHTTPProtocolClient(conn)
+}
+
+// RejectConnection will reply to the request of a connection rejected by admission control with a
+// 503 response and close it, the request is read first so that clients receive the response rather
+// than a connection closed while they were still writing
+func (p *HTTPProtocol) RejectConnection(conn net.Conn, err error) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(rejectTimeout))
+
+	c, _ := NewHTTPProtocolClient(conn)
+	c.limitHeaders()
+	if _, e := http.ReadRequest(c.Reader); e != nil {
+		return
+	}
+	c.unlimitHeaders()
+
+	p.writeResponse(c, http.StatusServiceUnavailable, map[string]interface{}{"error": err.Error()})
+	c.NetworkClient.Flush()
+}
+
+// RunClient will read http requests off of the connection one at a time and reply to each of them
+// until the client closes the connection, asks for it to be closed or sends QUIT
+func (p *HTTPProtocol) RunClient(client server.ProtocolClient) {
+	c, ok := client.(*HTTPProtocolClient)
+	if !ok {
+		client.WriteError(errInvalidProtocol)
+		client.Close()
+		return
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			buf := make([]byte, 4096)
+			n := runtime.Stack(buf, false)
+			buf = buf[0:n]
+			p.ctx.Log.Fatal("client run panic", errors.New(fmt.Sprintf("%v", e)), server.F("client", client.Id()), server.F("stack", string(buf)))
+		}
+
+		c.Close()
+		return
+	}()
+
+	for {
+		c.limitHeaders()
+		r, err := http.ReadRequest(c.Reader)
+		if exceeded := c.unlimitHeaders(); exceeded && err != nil {
+			err = errHeaderTooLarge
+			p.writeResponse(c, http.StatusRequestHeaderFieldsTooLarge, map[string]interface{}{"error": err.Error()})
+			c.NetworkClient.Flush()
+		}
+		if err != nil {
+			if err != io.EOF && !c.IsClosed() {
+				p.ctx.Log.Error("read error", err, server.F("client", client.Id()), server.F("addr", client.Address()))
+			}
+			return
+		}
+
+		quit := p.serve(c, r)
+		if err := c.NetworkClient.Flush(); err != nil || quit || r.Close || !discardBody(c, r) {
+			return
+		}
+	}
+}
+
+// discardBody will read whatever remains of the request body so that the next request can be read,
+// returning false when the body exceeds the bulk length limit and the connection should be closed
+func discardBody(c *HTTPProtocolClient, r *http.Request) bool {
+	max := c.Limits.MaxBulkLength
+	if max <= 0 {
+		_, err := io.Copy(io.Discard, r.Body)
+		return err == nil
+	}
+
+	_, err := io.CopyN(io.Discard, r.Body, max+1)
+	return err == io.EOF
+}
+
+// serve will dispatch the command of the request and write the response, returning true once the
+// connection should be closed
+func (p *HTTPProtocol) serve(c *HTTPProtocolClient, r *http.Request) bool {
+	req, err := p.request(c, r)
+	if err != nil {
+		p.writeResponse(c, statusCode(err), map[string]interface{}{"error": err.Error()})
+		// the remainder of a request exceeding the limits is never read, the connection is closed instead
+		return limitExceeded(err)
+	} else if req.Cmd == "QUIT" {
+		p.writeResponse(c, http.StatusOK, map[string]interface{}{"result": "OK"})
+		return true
+	}
+
+	// the user is resolved on every request so that a request without credentials never runs as
+	// the user of an earlier request on the same connection
+	c.SetUser(nil)
+	if user, password, ok := r.BasicAuth(); ok {
+		u, err := p.ctx.ACL.Authenticate(user, password)
+		if err != nil {
+			p.writeResponse(c, statusCode(err), map[string]interface{}{"error": err.Error()})
+			return false
+		}
+		c.SetUser(u)
+	}
+
+	// the reply is pending until flushed so that a graceful shutdown does not close the connection first
+	p.ctx.BeginReply()
+	defer p.ctx.EndReply()
+	defer c.NetworkClient.Flush()
+
+	values, err := p.dispatch(c, req)
+	if err != nil {
+		p.writeResponse(c, statusCode(err), map[string]interface{}{"error": err.Error()})
+	} else if len(values) == 0 {
+		// fire and forget commands do not reply
+		p.writeResponse(c, http.StatusNoContent, nil)
+	} else if len(values) == 1 {
+		p.writeResponse(c, http.StatusOK, map[string]interface{}{"result": values[0]})
+	} else {
+		p.writeResponse(c, http.StatusOK, map[string]interface{}{"result": values})
+	}
+	return false
+}
+
+// request will read the command from the path and its arguments from the args query parameters
+// (GET) or the json array body (POST), every argument is passed to the command as text
+func (p *HTTPProtocol) request(c *HTTPProtocolClient, r *http.Request) (server.Request, error) {
+	if !strings.HasPrefix(r.URL.Path, cmdPath) || len(r.URL.Path) == len(cmdPath) {
+		return server.Request{}, errNotFound
+	}
+
+	cmd := strings.ToUpper(strings.TrimPrefix(r.URL.Path, cmdPath))
+	var args [][]byte
+	switch r.Method {
+	case http.MethodGet:
+		for _, arg := range r.URL.Query()["args"] {
+			args = append(args, []byte(arg))
+		}
+	case http.MethodPost:
+		if max := c.Limits.MaxBulkLength; max > 0 && r.ContentLength > max {
+			return server.Request{}, errBodyTooLarge
+		}
+
+		if strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+			c.Writer.WriteString("HTTP/1.1 100 Continue")
+			c.Writer.Write(lineDelims)
+			c.Writer.Write(lineDelims)
+			c.NetworkClient.Flush()
+		}
+
+		body := io.Reader(r.Body)
+		max := c.Limits.MaxBulkLength
+		if max > 0 {
+			body = io.LimitReader(r.Body, max+1)
+		}
+
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return server.Request{}, err
+		} else if max > 0 && int64(len(b)) > max {
+			return server.Request{}, errBodyTooLarge
+		}
+
+		if len(bytes.TrimSpace(b)) > 0 {
+			var values []json.RawMessage
+			if err := json.Unmarshal(b, &values); err != nil {
+				return server.Request{}, errArgsFormat
+			}
+			for _, v := range values {
+				args = append(args, argBytes(v))
+			}
+		}
+	default:
+		return server.Request{}, errMethodNotAllowed
+	}
+
+	if max := c.Limits.MaxArrayLength; max > 0 && int64(len(args)) > max {
+		return server.Request{}, &server.LimitError{Limit: "array length", Size: int64(len(args)), Max: max}
+	}
+	if help, ok := p.ctx.CommandHelp[cmd]; ok && help.Flags.Has(server.FlagBlocking) {
+		return server.Request{}, fmt.Errorf("'%s' command is not supported over http", cmd)
+	}
+	return server.Request{Cmd: cmd, Args: args}, nil
+}
+
+// argBytes will convert a json argument to the text sent to the command, strings are unquoted,
+// null is empty and numbers, booleans, arrays and objects are passed as their json encoding
+func argBytes(v json.RawMessage) []byte {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return []byte(s)
+	} else if string(v) == "null" {
+		return []byte{}
+	}
+	return []byte(v)
+}
+
+// dispatch will run the command and return the values written by its handler
+func (p *HTTPProtocol) dispatch(c *HTTPProtocolClient, req server.Request) (values []interface{}, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			buf := make([]byte, 4096)
+			n := runtime.Stack(buf, false)
+			p.ctx.Log.Fatal("client run panic", errors.New(fmt.Sprintf("%v", e)), server.F("client", c.Id()), server.F("stack", string(buf[0:n])))
+			values, err = nil, errInternal
+		}
+	}()
+
+	c.reset()
+	if err := p.ctx.Dispatch(req.Cmd, req.Args, c); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+// writeResponse will write the status and json body (if any) of the response to the connection
+func (p *HTTPProtocol) writeResponse(c *HTTPProtocolClient, code int, body interface{}) {
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		if err != nil {
+			code = http.StatusInternalServerError
+			b, _ = json.Marshal(map[string]interface{}{"error": err.Error()})
+		}
+		b = append(b, '\n')
+	}
+
+	w := c.Writer
+	w.WriteString("HTTP/1.1 " + strconv.Itoa(code) + " " + http.StatusText(code))
+	w.Write(lineDelims)
+	if body != nil {
+		w.WriteString("Content-Type: application/json")
+		w.Write(lineDelims)
+	}
+	if code == http.StatusUnauthorized {
+		w.WriteString(`WWW-Authenticate: Basic realm="broadcast"`)
+		w.Write(lineDelims)
+	}
+	if code != http.StatusNoContent {
+		w.WriteString("Content-Length: " + strconv.Itoa(len(b)))
+		w.Write(lineDelims)
+	}
+	w.Write(lineDelims)
+	w.Write(b)
+}
+
+// limitExceeded will determine whether the error is the request exceeding the protocol limits
+func limitExceeded(err error) bool {
+	_, ok := err.(*server.LimitError)
+	return ok || err == errBodyTooLarge
+}
+
+// statusCode will map the error of a command to an http status code, errors are matched by their
+// code prefix (i.e. NOAUTH, NOPERM, RATELIMIT) or message
+func statusCode(err error) int {
+	msg := err.Error()
+	if _, ok := err.(*server.LimitError); ok {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	switch {
+	case err == errNotFound || err == server.ErrCmdNotFound:
+		return http.StatusNotFound
+	case err == errMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case err == errBodyTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case err == errHeaderTooLarge:
+		return http.StatusRequestHeaderFieldsTooLarge
+	case err == errInternal:
+		return http.StatusInternalServerError
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case strings.HasPrefix(msg, "NOAUTH"), strings.HasPrefix(msg, "WRONGPASS"):
+		return http.StatusUnauthorized
+	case strings.HasPrefix(msg, "NOPERM"):
+		return http.StatusForbidden
+	case strings.HasPrefix(msg, "RATELIMIT"):
+		return http.StatusTooManyRequests
+	case strings.HasPrefix(msg, "SHUTDOWN"):
+		return http.StatusServiceUnavailable
+	case strings.HasPrefix(msg, "EXECABORT"):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
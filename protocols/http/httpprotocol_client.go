@@ -0,0 +1,230 @@
+package httpProtocol
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/nyxtom/broadcast/server"
+)
+
+// HTTPProtocolClient collects the typed replies written by command handlers as json values, the
+// reply is written to the connection as an http response once the command has finished
+type HTTPProtocolClient struct {
+	server.NetworkClient
+
+	values  []interface{}  // top level values written
+	open    []*jsonArray   // arrays still being filled, innermost last
+	headers *headerLimiter // bounds the bytes read for the headers of a request
+}
+
+// headerLimiter bounds the bytes read from the connection while the headers of a request are
+// read, the body is bounded separately by the bulk length limit
+type headerLimiter struct {
+	r         io.Reader
+	remaining int64 // bytes that may still be read (negative for no limit)
+}
+
+func (l *headerLimiter) Read(p []byte) (int, error) {
+	if l.remaining == 0 {
+		return 0, errHeaderTooLarge
+	} else if l.remaining > 0 && int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.r.Read(p)
+	if l.remaining > 0 {
+		l.remaining -= int64(n)
+	}
+	return n, err
+}
+
+// jsonArray is an array of the reply along with the number of elements it was declared with
+type jsonArray struct {
+	values []interface{}
+	n      int
+}
+
+// jsonError is an error written within an array (i.e. by EXEC)
+type jsonError struct {
+	Error string `json:"error"`
+}
+
+func NewHTTPProtocolClient(conn net.Conn) (*HTTPProtocolClient, error) {
+	return NewHTTPProtocolClientSize(conn, 4096)
+}
+
+func NewHTTPProtocolClientSize(conn net.Conn, bufferSize int) (*HTTPProtocolClient, error) {
+	client := new(HTTPProtocolClient)
+	client.Initialize(conn, bufferSize)
+	client.headers = &headerLimiter{client.Reader, -1}
+	client.Reader = bufio.NewReaderSize(client.headers, bufferSize)
+	return client, nil
+}
+
+// limitHeaders will bound the bytes read for the headers of the next request by the line length
+// limit of the client (or the default header limit of net/http when there is none)
+func (client *HTTPProtocolClient) limitHeaders() {
+	if max := client.Limits.MaxLineLength; max > 0 {
+		client.headers.remaining = int64(max)
+	} else {
+		client.headers.remaining = http.DefaultMaxHeaderBytes
+	}
+}
+
+// unlimitHeaders will stop bounding the bytes read once the headers have been read, returning
+// whether the limit was reached (the headers exceeded it when they failed to be read)
+func (client *HTTPProtocolClient) unlimitHeaders() bool {
+	exceeded := client.headers.remaining == 0
+	client.headers.remaining = -1
+	return exceeded
+}
+
+// reset will discard the reply of the previous request
+func (client *HTTPProtocolClient) reset() {
+	client.values = nil
+	client.open = nil
+}
+
+// reply will return the values written, an error written on its own is returned as the error
+func (client *HTTPProtocolClient) reply() ([]interface{}, error) {
+	if len(client.values) == 1 {
+		if e, ok := client.values[0].(jsonError); ok {
+			return nil, errors.New(e.Error)
+		}
+	}
+	return client.values, nil
+}
+
+// add will append the value to the innermost open array (closing any arrays that are now full)
+// or to the top level values
+func (client *HTTPProtocolClient) add(v interface{}) error {
+	for len(client.open) > 0 {
+		top := client.open[len(client.open)-1]
+		top.values = append(top.values, v)
+		if len(top.values) < top.n {
+			return nil
+		}
+		client.open = client.open[:len(client.open)-1]
+		v = top.values
+	}
+	client.values = append(client.values, v)
+	return nil
+}
+
+// Flush is a no-op, the reply is written once the command has finished
+func (client *HTTPProtocolClient) Flush() error {
+	return nil
+}
+
+// Write will add the bytes as a string
+func (client *HTTPProtocolClient) Write(b []byte) (int, error) {
+	return len(b), client.add(string(b))
+}
+
+// WriteLen will open an array of n elements (null when n is negative), other prefixes are ignored
+func (client *HTTPProtocolClient) WriteLen(prefix byte, n int) error {
+	if prefix != '*' {
+		return nil
+	} else if n < 0 {
+		return client.add(nil)
+	} else if n == 0 {
+		return client.add([]interface{}{})
+	}
+
+	client.open = append(client.open, &jsonArray{make([]interface{}, 0, n), n})
+	return nil
+}
+
+func (client *HTTPProtocolClient) WriteString(s string) error {
+	return client.add(s)
+}
+
+func (client *HTTPProtocolClient) WriteByte(b byte) error {
+	return client.add(string(b))
+}
+
+func (client *HTTPProtocolClient) WriteBytes(b []byte) error {
+	return client.add(string(b))
+}
+
+func (client *HTTPProtocolClient) WriteInt64(n int64) error {
+	return client.add(n)
+}
+
+func (client *HTTPProtocolClient) WriteFloat64(n float64) error {
+	return client.add(n)
+}
+
+func (client *HTTPProtocolClient) WriteBool(b bool) error {
+	return client.add(b)
+}
+
+func (client *HTTPProtocolClient) WriteError(e error) error {
+	if e == nil {
+		return client.add(jsonError{""})
+	}
+	return client.add(jsonError{e.Error()})
+}
+
+func (client *HTTPProtocolClient) WriteNull() error {
+	return client.add(nil)
+}
+
+func (client *HTTPProtocolClient) WriteBulk(data [][]byte) error {
+	values := make([]interface{}, len(data))
+	for i, v := range data {
+		values[i] = string(v)
+	}
+	return client.add(values)
+}
+
+func (client *HTTPProtocolClient) WriteInterface(arg interface{}) error {
+	return client.add(jsonValue(arg))
+}
+
+func (client *HTTPProtocolClient) WriteArray(args []interface{}) error {
+	return client.add(jsonValue(args))
+}
+
+// WriteJson will add the json encoding of the value as is rather than as a string
+func (client *HTTPProtocolClient) WriteJson(arg interface{}) error {
+	b, err := json.Marshal(arg)
+	if err != nil {
+		return err
+	}
+	return client.add(json.RawMessage(b))
+}
+
+func (client *HTTPProtocolClient) WriteCommand(cmd string, args []interface{}) error {
+	values := make([]interface{}, len(args)+1)
+	values[0] = strings.ToUpper(cmd)
+	for i, v := range args {
+		values[i+1] = jsonValue(v)
+	}
+	return client.add(values)
+}
+
+// jsonValue will convert the value to one that encodes as expected in json (i.e. []byte as a string
+// rather than base64)
+func jsonValue(arg interface{}) interface{} {
+	switch arg := arg.(type) {
+	case []byte:
+		return string(arg)
+	case byte:
+		return string(arg)
+	case error:
+		return jsonError{arg.Error()}
+	case []interface{}:
+		values := make([]interface{}, len(arg))
+		for i, v := range arg {
+			values[i] = jsonValue(v)
+		}
+		return values
+	}
+	return arg
+}
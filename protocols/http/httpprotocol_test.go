@@ -0,0 +1,215 @@
+package httpProtocol
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nyxtom/broadcast/server"
+)
+
+// newTestGateway will create a context with an ECHO command served by the http protocol
+func newTestGateway(t *testing.T) *server.BroadcastContext {
+	ctx := server.NewBroadcastContext()
+	ctx.RegisterCommand(server.Command{Name: "ECHO", Usage: "ECHO value", MinArgs: 1, MaxArgs: 1, Flags: server.FlagReadOnly},
+		func(data interface{}, client server.ProtocolClient) error {
+			client.WriteBytes(data.([][]byte)[0])
+			return client.Flush()
+		})
+	return ctx
+}
+
+// connect will serve a new pipe connection over the http protocol and return the other end
+func connect(t *testing.T, ctx *server.BroadcastContext) (net.Conn, *bufio.Reader) {
+	p := NewHTTPProtocol()
+	if err := p.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	client, err := p.HandleConnection(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetLimits(ctx.Limits)
+	go p.RunClient(client)
+
+	t.Cleanup(func() { peer.Close() })
+	return peer, bufio.NewReader(peer)
+}
+
+// roundTrip will write the raw request and read the response along with its json body
+func roundTrip(t *testing.T, conn net.Conn, r *bufio.Reader, request string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	go conn.Write([]byte(request))
+	return response(t, conn, r)
+}
+
+// response will read the next response and its json body
+func response(t *testing.T, conn net.Conn, r *bufio.Reader) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	defer res.Body.Close()
+
+	var body map[string]interface{}
+	if b, _ := io.ReadAll(res.Body); len(b) > 0 {
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Fatalf("invalid response body %q: %v", b, err)
+		}
+	}
+	return res, body
+}
+
+// expectClosed will ensure the server has closed the connection
+func expectClosed(t *testing.T, conn net.Conn, r *bufio.Reader) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Fatalf("expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestGatewayCommands(t *testing.T) {
+	ctx := newTestGateway(t)
+	conn, r := connect(t, ctx)
+
+	res, body := roundTrip(t, conn, r, "GET /cmd/echo?args=foo HTTP/1.1\r\nHost: test\r\n\r\n")
+	if res.StatusCode != http.StatusOK || body["result"] != "foo" {
+		t.Fatalf("expected foo, got %d %v", res.StatusCode, body)
+	}
+
+	// the connection is kept alive between requests
+	res, body = roundTrip(t, conn, r, "POST /cmd/ECHO HTTP/1.1\r\nHost: test\r\nContent-Length: 7\r\n\r\n[\"bar\"]")
+	if res.StatusCode != http.StatusOK || body["result"] != "bar" {
+		t.Fatalf("expected bar, got %d %v", res.StatusCode, body)
+	}
+
+	res, body = roundTrip(t, conn, r, "GET /cmd/ECHO HTTP/1.1\r\nHost: test\r\n\r\n")
+	if res.StatusCode != http.StatusBadRequest || !strings.HasPrefix(body["error"].(string), "wrong number of arguments") {
+		t.Fatalf("expected an arity error, got %d %v", res.StatusCode, body)
+	}
+
+	res, _ = roundTrip(t, conn, r, "GET /cmd/NOPE HTTP/1.1\r\nHost: test\r\n\r\n")
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected not found, got %d", res.StatusCode)
+	}
+
+	// the unread body of a request is discarded before the next request is read
+	res, body = roundTrip(t, conn, r, "GET /cmd/ECHO?args=baz HTTP/1.1\r\nHost: test\r\nContent-Length: 5\r\n\r\nxxxxx")
+	if res.StatusCode != http.StatusOK || body["result"] != "baz" {
+		t.Fatalf("expected baz, got %d %v", res.StatusCode, body)
+	}
+	res, body = roundTrip(t, conn, r, "GET /cmd/ECHO?args=qux HTTP/1.1\r\nHost: test\r\n\r\n")
+	if res.StatusCode != http.StatusOK || body["result"] != "qux" {
+		t.Fatalf("expected qux, got %d %v", res.StatusCode, body)
+	}
+}
+
+func TestGatewayBasicAuth(t *testing.T) {
+	ctx := newTestGateway(t)
+	ctx.ACL.AddUser(&server.User{
+		Name:     "app",
+		Password: "secret",
+		Commands: []string{"+@all"},
+	})
+	conn, r := connect(t, ctx)
+
+	res, _ := roundTrip(t, conn, r, "GET /cmd/ECHO?args=a HTTP/1.1\r\nHost: test\r\nAuthorization: Basic YXBwOnNlY3JldA==\r\n\r\n")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the authenticated request to succeed, got %d", res.StatusCode)
+	}
+
+	// credentials are never carried over to the next request on the connection
+	res, _ = roundTrip(t, conn, r, "GET /cmd/ECHO?args=a HTTP/1.1\r\nHost: test\r\n\r\n")
+	if res.StatusCode != http.StatusUnauthorized || res.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected the request without credentials to be unauthorized, got %d", res.StatusCode)
+	}
+
+	res, _ = roundTrip(t, conn, r, "GET /cmd/ECHO?args=a HTTP/1.1\r\nHost: test\r\nAuthorization: Basic YXBwOndyb25n\r\n\r\n")
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the wrong password to be unauthorized, got %d", res.StatusCode)
+	}
+}
+
+func TestGatewayHeaderLimit(t *testing.T) {
+	ctx := newTestGateway(t)
+	ctx.Limits.MaxLineLength = 1024
+	conn, r := connect(t, ctx)
+
+	// the rest of the header is never read, so the write is left to fail once the connection closes
+	go conn.Write([]byte("GET /cmd/ECHO?args=a HTTP/1.1\r\nHost: test\r\nX-Big: " + strings.Repeat("a", 1<<20) + "\r\n\r\n"))
+	res, _ := response(t, conn, r)
+	if res.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Fatalf("expected the headers to be too large, got %d", res.StatusCode)
+	}
+	expectClosed(t, conn, r)
+}
+
+func TestGatewayHeadersWithinLimit(t *testing.T) {
+	ctx := newTestGateway(t)
+	ctx.Limits.MaxLineLength = 1024
+	conn, r := connect(t, ctx)
+
+	// the limit applies to every request on its own rather than the connection
+	for i := 0; i < 4; i++ {
+		res, _ := roundTrip(t, conn, r, "GET /cmd/ECHO?args=a HTTP/1.1\r\nHost: test\r\nX-Pad: "+strings.Repeat("a", 512)+"\r\n\r\n")
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected headers within the limit to be read, got %d", res.StatusCode)
+		}
+	}
+}
+
+func TestGatewayBodyLimit(t *testing.T) {
+	ctx := newTestGateway(t)
+	ctx.Limits.MaxBulkLength = 16
+
+	// a declared length above the limit is rejected without reading the body
+	conn, r := connect(t, ctx)
+	go conn.Write([]byte("POST /cmd/ECHO HTTP/1.1\r\nHost: test\r\nContent-Length: 67108864\r\n\r\n"))
+	res, _ := response(t, conn, r)
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected the body to be too large, got %d", res.StatusCode)
+	}
+	expectClosed(t, conn, r)
+
+	// chunked bodies are read up to the limit
+	conn, r = connect(t, ctx)
+	go conn.Write([]byte("POST /cmd/ECHO HTTP/1.1\r\nHost: test\r\nTransfer-Encoding: chunked\r\n\r\n20\r\n[\"" + strings.Repeat("a", 28) + "\"]\r\n0\r\n\r\n"))
+	res, _ = response(t, conn, r)
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected the body to be too large, got %d", res.StatusCode)
+	}
+	expectClosed(t, conn, r)
+
+	// an unread body above the limit closes the connection rather than being discarded
+	conn, r = connect(t, ctx)
+	go conn.Write([]byte("GET /cmd/ECHO?args=a HTTP/1.1\r\nHost: test\r\nContent-Length: 32\r\n\r\n" + strings.Repeat("a", 32)))
+	res, _ = response(t, conn, r)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the command to succeed, got %d", res.StatusCode)
+	}
+	expectClosed(t, conn, r)
+}
+
+func TestGatewayRejectedConnection(t *testing.T) {
+	conn, peer := net.Pipe()
+	t.Cleanup(func() { peer.Close() })
+	go NewHTTPProtocol().RejectConnection(conn, errors.New("max number of clients reached"))
+
+	r := bufio.NewReader(peer)
+	res, body := roundTrip(t, peer, r, "GET /cmd/ECHO?args=a HTTP/1.1\r\nHost: test\r\n\r\n")
+	if res.StatusCode != http.StatusServiceUnavailable || body["error"] != "max number of clients reached" {
+		t.Fatalf("expected the connection to be rejected with 503, got %d %v", res.StatusCode, body)
+	}
+	expectClosed(t, peer, r)
+}
@@ -28,7 +28,7 @@ func (p *LineProtocol) Name() string {
 	return "line"
 }
 
-func (p *LineProtocol) HandleConnection(conn *net.TCPConn) (server.ProtocolClient, error) {
+func (p *LineProtocol) HandleConnection(conn net.Conn) (server.ProtocolClient, error) {
 	return NewLineProtocolClientSize(conn, 128)
 }
 
@@ -45,53 +45,30 @@ func (p *LineProtocol) RunClient(client server.ProtocolClient) {
 			buf := make([]byte, 4096)
 			n := runtime.Stack(buf, false)
 			buf = buf[0:n]
-			p.ctx.Events <- server.BroadcastEvent{"fatal", "client run panic", errors.New(fmt.Sprintf("%v", e)), buf}
+			p.ctx.Log.Fatal("client run panic", errors.New(fmt.Sprintf("%v", e)), server.F("client", client.Id()), server.F("stack", string(buf)))
 		}
 
 		c.Close()
 		return
 	}()
 
-	reqErr := client.RequestErrorChan()
-	for {
+	err := p.ctx.Serve(client, func() (server.Request, error) {
 		data, err := c.readBulk()
-
 		if err != nil {
-			if err != io.EOF {
-				p.ctx.Events <- server.BroadcastEvent{"error", "read error", err, nil}
-			}
-			return
+			return server.Request{}, err
 		}
+		return server.Request{Cmd: strings.ToUpper(string(data[0])), Args: data[1:]}, nil
+	})
 
-		err = p.handleData(data, c, reqErr)
-		if err != nil {
-			if err == errQuit {
-				return
-			} else {
-				p.ctx.Events <- server.BroadcastEvent{"error", "accept error", err, nil}
-				c.WriteError(err)
-				c.Flush()
-			}
+	if err != nil && err != server.ErrQuit {
+		if _, ok := err.(*server.LimitError); ok {
+			c.LockWrites()
+			c.WriteError(err)
+			c.Flush()
+			c.UnlockWrites()
 		}
-	}
-}
-
-func (p *LineProtocol) handleData(data [][]byte, client *LineProtocolClient, reqErr chan error) error {
-	cmd := strings.ToUpper(string(data[0]))
-	switch {
-	case cmd == "QUIT":
-		return errQuit
-	default:
-		handler, ok := p.ctx.Commands[cmd]
-		if !ok {
-			return errCmdNotFound
+		if err != io.EOF && !client.IsClosed() {
+			p.ctx.Log.Error("read error", err, server.F("client", client.Id()), server.F("addr", client.Address()))
 		}
-
-		var err error
-		go func() {
-			reqErr <- handler(data[1:], client)
-		}()
-		err = <-reqErr
-		return err
 	}
 }
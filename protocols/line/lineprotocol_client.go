@@ -13,11 +13,11 @@ type LineProtocolClient struct {
 	server.NetworkClient
 }
 
-func NewLineProtocolClient(conn *net.TCPConn) (*LineProtocolClient, error) {
+func NewLineProtocolClient(conn net.Conn) (*LineProtocolClient, error) {
 	return NewLineProtocolClientSize(conn, 128)
 }
 
-func NewLineProtocolClientSize(conn *net.TCPConn, bufferSize int) (*LineProtocolClient, error) {
+func NewLineProtocolClientSize(conn net.Conn, bufferSize int) (*LineProtocolClient, error) {
 	client := new(LineProtocolClient)
 	client.Initialize(conn, bufferSize)
 	return client, nil
@@ -31,7 +31,12 @@ func (proto *LineProtocolClient) readBulk() ([][]byte, error) {
 		return nil, errReadRequest
 	}
 
-	return bytes.Split(line, splitBulkDelim), nil
+	data := bytes.Split(line, splitBulkDelim)
+	if max := proto.Limits.MaxArrayLength; max > 0 && int64(len(data)) > max {
+		return nil, &server.LimitError{Limit: "array length", Size: int64(len(data)), Max: max}
+	}
+
+	return data, nil
 }
 
 func (client *LineProtocolClient) WriteCommand(cmd string, args []interface{}) error {
@@ -11,9 +11,6 @@ import (
 	"github.com/nyxtom/broadcast/server"
 )
 
-var errCmdNotFound = errors.New("invalid command format")
-var errQuit = errors.New("client quit")
-
 type RedisProtocol struct {
 	ctx *server.BroadcastContext
 }
@@ -31,7 +28,7 @@ func (p *RedisProtocol) Name() string {
 	return "redis"
 }
 
-func (p *RedisProtocol) HandleConnection(conn *net.TCPConn) (server.ProtocolClient, error) {
+func (p *RedisProtocol) HandleConnection(conn net.Conn) (server.ProtocolClient, error) {
 	return NewRedisProtocolClientSize(conn, 128)
 }
 
@@ -42,54 +39,38 @@ func (p *RedisProtocol) RunClient(client server.ProtocolClient) {
 			buf := make([]byte, 4096)
 			n := runtime.Stack(buf, false)
 			buf = buf[0:n]
-			p.ctx.Events <- server.BroadcastEvent{"fatal", "client run panic", errors.New(fmt.Sprintf("%v", e)), buf}
+			p.ctx.Log.Fatal("client run panic", errors.New(fmt.Sprintf("%v", e)), server.F("client", client.Id()), server.F("stack", string(buf)))
 		}
 
 		client.Close()
 		return
 	}()
 
-	reqErr := client.RequestErrorChan()
-	for {
-		data, err := client.ReadBulkPayload()
-		if err != nil {
-			if err != io.EOF {
-				p.ctx.Events <- server.BroadcastEvent{"error", "read error", err, nil}
+	err := p.ctx.Serve(client, func() (server.Request, error) {
+		for {
+			data, err := client.ReadBulkPayload()
+			if err != nil {
+				return server.Request{}, err
+			} else if len(data) > 0 {
+				return server.Request{Cmd: strings.ToUpper(string(data[0])), Args: data[1:]}, nil
 			}
-			return
 		}
+	})
 
-		err = p.handleData(data, client, reqErr)
-		if err != nil {
-			if err == errQuit {
-				client.WriteString("OK")
-				client.Flush()
-				return
-			} else {
-				p.ctx.Events <- server.BroadcastEvent{"error", "accept error", err, nil}
-				client.WriteError(err)
-				client.Flush()
-			}
+	if err == server.ErrQuit {
+		client.LockWrites()
+		client.WriteString("OK")
+		client.Flush()
+		client.UnlockWrites()
+	} else if err != nil {
+		if _, ok := err.(*server.LimitError); ok {
+			client.LockWrites()
+			client.WriteError(err)
+			client.Flush()
+			client.UnlockWrites()
 		}
-	}
-}
-
-func (p *RedisProtocol) handleData(data [][]byte, client server.ProtocolClient, reqErr chan error) error {
-	cmd := strings.ToUpper(string(data[0]))
-	switch {
-	case cmd == "QUIT":
-		return errQuit
-	default:
-		handler, ok := p.ctx.Commands[cmd]
-		if !ok {
-			return errCmdNotFound
+		if err != io.EOF && !client.IsClosed() {
+			p.ctx.Log.Error("read error", err, server.F("client", client.Id()), server.F("addr", client.Address()))
 		}
-
-		var err error
-		go func() {
-			reqErr <- handler(data[1:], client)
-		}()
-		err = <-reqErr
-		return err
 	}
 }
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"path"
+	"strings"
+	"sync"
+)
+
+// DefaultUser is the name of the user that unauthenticated clients act as (when configured)
+var DefaultUser = "default"
+
+var errNoAuth = errors.New("NOAUTH authentication required")
+var errInvalidAuth = errors.New("WRONGPASS invalid username-password pair")
+
+// User describes an account clients can authenticate as and the commands it is permitted to run.
+// Commands are rules evaluated in order where the last matching rule wins, rules are either
+// a command pattern (+GET, -DEL, +S*, +*) or a category (+@read, -@write, +@all).
+type User struct {
+	Name     string   // name of the user
+	Password string   // password of the user in plain text or as sha256:<hex digest>
+	Commands []string // ordered command rules for the user
+}
+
+// ACL is the access control list of users and command categories for the broadcast server,
+// when no users are defined every client is permitted to run every command
+type ACL struct {
+	sync.RWMutex
+
+	users      map[string]*User
+	categories map[string]map[string]struct{}
+}
+
+func NewACL() *ACL {
+	acl := new(ACL)
+	acl.users = make(map[string]*User)
+	acl.categories = make(map[string]map[string]struct{})
+	return acl
+}
+
+// AddUser will add or replace the given user, enabling authentication for the server
+func (acl *ACL) AddUser(user *User) {
+	acl.Lock()
+	defer acl.Unlock()
+	acl.users[user.Name] = user
+}
+
+// Enabled will determine whether any users have been defined
+func (acl *ACL) Enabled() bool {
+	acl.RLock()
+	defer acl.RUnlock()
+	return len(acl.users) > 0
+}
+
+// RegisterCategory will add the given commands to the category (i.e. read, write, admin)
+func (acl *ACL) RegisterCategory(category string, cmds ...string) {
+	acl.Lock()
+	defer acl.Unlock()
+	category = strings.ToLower(category)
+	c, ok := acl.categories[category]
+	if !ok {
+		c = make(map[string]struct{})
+		acl.categories[category] = c
+	}
+	for _, cmd := range cmds {
+		c[strings.ToUpper(cmd)] = struct{}{}
+	}
+}
+
+// Categories will return the categories the given command belongs to
+func (acl *ACL) Categories(cmd string) []string {
+	acl.RLock()
+	defer acl.RUnlock()
+	results := make([]string, 0)
+	for category, cmds := range acl.categories {
+		if _, ok := cmds[cmd]; ok {
+			results = append(results, category)
+		}
+	}
+	return results
+}
+
+// Authenticate will find the user by name and verify the given password
+func (acl *ACL) Authenticate(name string, password string) (*User, error) {
+	acl.RLock()
+	user, ok := acl.users[name]
+	acl.RUnlock()
+	if !ok || !user.checkPassword(password) {
+		return nil, errInvalidAuth
+	}
+
+	return user, nil
+}
+
+// Authorize will determine whether the client is permitted to run the given command, clients that
+// have not authenticated act as the user named by their verified client certificate (if there is
+// one) or otherwise as the default user (if there is one)
+func (acl *ACL) Authorize(cmd string, client ProtocolClient) error {
+	if cmd == "AUTH" || !acl.Enabled() {
+		return nil
+	}
+
+	user := client.User()
+	if user == nil {
+		user = acl.identified(client)
+	}
+	if user == nil {
+		acl.RLock()
+		user = acl.users[DefaultUser]
+		acl.RUnlock()
+		if user == nil || len(user.Password) > 0 {
+			return errNoAuth
+		}
+	}
+
+	if !acl.allowed(user, cmd) {
+		return errors.New("NOPERM user " + user.Name + " has no permissions to run the '" + cmd + "' command")
+	}
+	return nil
+}
+
+// identified will return the user named by the common name of the client's verified certificate,
+// the certificate authenticates the client in place of the user's password
+func (acl *ACL) identified(client ProtocolClient) *User {
+	identity := client.Identity()
+	if len(identity) == 0 {
+		return nil
+	}
+
+	acl.RLock()
+	defer acl.RUnlock()
+	return acl.users[identity]
+}
+
+// allowed will evaluate the user's command rules in order, the last matching rule wins
+func (acl *ACL) allowed(user *User, cmd string) bool {
+	acl.RLock()
+	defer acl.RUnlock()
+
+	allowed := false
+	for _, rule := range user.Commands {
+		if len(rule) < 2 || (rule[0] != '+' && rule[0] != '-') {
+			continue
+		}
+
+		match := false
+		pattern := rule[1:]
+		if pattern[0] == '@' {
+			category := strings.ToLower(pattern[1:])
+			if category == "all" {
+				match = true
+			} else {
+				_, match = acl.categories[category][cmd]
+			}
+		} else {
+			match, _ = path.Match(strings.ToUpper(pattern), cmd)
+		}
+
+		if match {
+			allowed = rule[0] == '+'
+		}
+	}
+
+	return allowed
+}
+
+// checkPassword will compare the given password in constant time against the user's password
+func (user *User) checkPassword(password string) bool {
+	expected := user.Password
+	if strings.HasPrefix(expected, "sha256:") {
+		digest := sha256.Sum256([]byte(password))
+		password = hex.EncodeToString(digest[:])
+		expected = strings.ToLower(expected[len("sha256:"):])
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errMaxClients      = errors.New("max number of clients reached")
+	errMaxClientsPerIP = errors.New("max number of clients per address reached")
+	errAcceptRate      = errors.New("connection rate limit exceeded")
+)
+
+// rejectTimeout is how long a rejected connection is given to receive its error
+const rejectTimeout = time.Second
+
+// Admission controls which incoming connections are accepted by the server. Connections can be
+// limited overall, per source address and by the rate at which they are accepted (0 for no limit).
+type Admission struct {
+	sync.Mutex
+
+	MaxClients      int     // maximum number of connections overall
+	MaxClientsPerIP int     // maximum number of connections from a single source address
+	AcceptRate      float64 // maximum number of connections accepted per second
+	AcceptBurst     int     // number of connections that may be accepted at once above the rate
+
+	active int            // number of admitted connections
+	perIP  map[string]int // number of admitted connections by source address
+	tokens float64        // available accept tokens
+	last   time.Time      // last time the accept tokens were replenished
+
+	Accepted           int64 // connections admitted
+	RejectedMaxClients int64 // connections rejected by the max clients limit
+	RejectedPerIP      int64 // connections rejected by the per address limit
+	RejectedRate       int64 // connections rejected by the accept rate limit
+}
+
+// NewAdmission will create an admission control without any limits
+func NewAdmission() *Admission {
+	admission := new(Admission)
+	admission.perIP = make(map[string]int)
+	return admission
+}
+
+// Admit will determine whether the connection may be accepted, admitted connections must be
+// released once they have closed
+func (a *Admission) Admit(conn net.Conn) error {
+	ip := sourceIP(conn)
+
+	a.Lock()
+	defer a.Unlock()
+
+	if a.MaxClients > 0 && a.active >= a.MaxClients {
+		atomic.AddInt64(&a.RejectedMaxClients, 1)
+		return errMaxClients
+	}
+
+	if a.MaxClientsPerIP > 0 && len(ip) > 0 && a.perIP[ip] >= a.MaxClientsPerIP {
+		atomic.AddInt64(&a.RejectedPerIP, 1)
+		return errMaxClientsPerIP
+	}
+
+	// the accept rate is checked last so that connections rejected by the other limits never take
+	// a token from the connections that would have been admitted
+	if a.AcceptRate > 0 && !a.take() {
+		atomic.AddInt64(&a.RejectedRate, 1)
+		return errAcceptRate
+	}
+
+	a.active++
+	if len(ip) > 0 {
+		a.perIP[ip]++
+	}
+	atomic.AddInt64(&a.Accepted, 1)
+	return nil
+}
+
+// Release will release a previously admitted connection
+func (a *Admission) Release(conn net.Conn) {
+	ip := sourceIP(conn)
+
+	a.Lock()
+	defer a.Unlock()
+
+	a.active--
+	if len(ip) > 0 {
+		if a.perIP[ip] <= 1 {
+			delete(a.perIP, ip)
+		} else {
+			a.perIP[ip]--
+		}
+	}
+}
+
+// Rejected will return the total number of connections that have been rejected
+func (a *Admission) Rejected() int64 {
+	return atomic.LoadInt64(&a.RejectedMaxClients) + atomic.LoadInt64(&a.RejectedPerIP) + atomic.LoadInt64(&a.RejectedRate)
+}
+
+// take will replenish the accept tokens based on the time elapsed and attempt to take one
+func (a *Admission) take() bool {
+	burst := float64(a.AcceptBurst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	now := time.Now()
+	if a.last.IsZero() {
+		a.tokens = burst
+	} else {
+		a.tokens += now.Sub(a.last).Seconds() * a.AcceptRate
+		if a.tokens > burst {
+			a.tokens = burst
+		}
+	}
+	a.last = now
+
+	if a.tokens < 1 {
+		return false
+	}
+
+	a.tokens--
+	return true
+}
+
+// rejectConnection will reply to the rejected connection in the format of the listener's protocol
+// when it implements ConnectionRejecter, or with the common error reply otherwise
+func rejectConnection(l *BroadcastListener, conn net.Conn, err error) {
+	if rejecter, ok := l.protocol.(ConnectionRejecter); ok {
+		rejecter.RejectConnection(conn, err)
+	} else {
+		reject(conn, err)
+	}
+}
+
+// reject will write the admission error to the connection and close it, the error uses the
+// common error reply shared by the redis, interface and line protocols so that clients can
+// report it cleanly
+func reject(conn net.Conn, err error) {
+	client := BufferClient{}
+	client.Writer = bufio.NewWriter(conn)
+	conn.SetWriteDeadline(time.Now().Add(rejectTimeout))
+	client.WriteError(err)
+	client.Flush()
+	conn.Close()
+}
+
+// sourceIP will return the source ip address of the connection (empty for non ip connections)
+func sourceIP(conn net.Conn) string {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
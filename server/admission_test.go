@@ -0,0 +1,195 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// addrConn is a connection from the given remote address, only the address is used by admission
+type addrConn struct {
+	net.Conn
+
+	addr net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr { return c.addr }
+
+// connFrom will return a connection from the given ip address
+func connFrom(ip string) net.Conn {
+	return addrConn{addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 6379}}
+}
+
+func TestAdmissionMaxClients(t *testing.T) {
+	a := NewAdmission()
+	a.MaxClients = 2
+
+	first, second := connFrom("10.0.0.1"), connFrom("10.0.0.2")
+	if err := a.Admit(first); err != nil {
+		t.Fatal(err)
+	} else if err := a.Admit(second); err != nil {
+		t.Fatal(err)
+	} else if err := a.Admit(connFrom("10.0.0.3")); err != errMaxClients {
+		t.Fatalf("expected the max clients to be enforced, got %v", err)
+	}
+
+	a.Release(first)
+	if err := a.Admit(connFrom("10.0.0.3")); err != nil {
+		t.Fatalf("expected a released connection to make room, got %v", err)
+	}
+
+	if a.Accepted != 3 || a.RejectedMaxClients != 1 || a.Rejected() != 1 {
+		t.Fatalf("expected 3 accepted and 1 rejected, got %d accepted and %d rejected", a.Accepted, a.Rejected())
+	}
+}
+
+func TestAdmissionMaxClientsPerIP(t *testing.T) {
+	a := NewAdmission()
+	a.MaxClientsPerIP = 2
+
+	first := connFrom("10.0.0.1")
+	for i := 0; i < 2; i++ {
+		if err := a.Admit(connFrom("10.0.0.1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Admit(first); err != errMaxClientsPerIP {
+		t.Fatalf("expected the per address limit to be enforced, got %v", err)
+	} else if err := a.Admit(connFrom("10.0.0.2")); err != nil {
+		t.Fatalf("expected other addresses to be admitted, got %v", err)
+	}
+
+	// connections without an ip address are not limited by address
+	for i := 0; i < 3; i++ {
+		if err := a.Admit(addrConn{addr: pipeAddr{}}); err != nil {
+			t.Fatalf("expected connections without an address to be admitted, got %v", err)
+		}
+	}
+
+	a.Release(first)
+	if err := a.Admit(first); err != nil {
+		t.Fatalf("expected a released connection to make room, got %v", err)
+	}
+
+	a.Release(first)
+	a.Release(first)
+	if _, ok := a.perIP["10.0.0.1"]; ok {
+		t.Fatal("expected the address to be forgotten once every connection is released")
+	}
+	if a.RejectedPerIP != 1 {
+		t.Fatalf("expected 1 connection rejected by address, got %d", a.RejectedPerIP)
+	}
+}
+
+func TestAdmissionAcceptRate(t *testing.T) {
+	a := NewAdmission()
+	a.AcceptRate = 10
+	a.AcceptBurst = 3
+
+	for i := 0; i < 3; i++ {
+		if err := a.Admit(connFrom("10.0.0.1")); err != nil {
+			t.Fatalf("expected the burst to be admitted, got %v", err)
+		}
+	}
+	if err := a.Admit(connFrom("10.0.0.1")); err != errAcceptRate {
+		t.Fatalf("expected the accept rate to be enforced, got %v", err)
+	}
+
+	// 150ms replenishes a token and a half at 10 per second
+	a.Lock()
+	a.last = a.last.Add(-150 * time.Millisecond)
+	a.Unlock()
+	if err := a.Admit(connFrom("10.0.0.1")); err != nil {
+		t.Fatalf("expected a replenished token to be admitted, got %v", err)
+	} else if err := a.Admit(connFrom("10.0.0.1")); err != errAcceptRate {
+		t.Fatalf("expected a single token to be replenished, got %v", err)
+	}
+
+	// tokens never replenish beyond the burst
+	a.Lock()
+	a.last = a.last.Add(-time.Hour)
+	a.Unlock()
+	for i := 0; i < 3; i++ {
+		if err := a.Admit(connFrom("10.0.0.1")); err != nil {
+			t.Fatalf("expected the burst to be admitted, got %v", err)
+		}
+	}
+	if err := a.Admit(connFrom("10.0.0.1")); err != errAcceptRate {
+		t.Fatalf("expected the burst to be enforced, got %v", err)
+	}
+
+	if a.RejectedRate != 3 {
+		t.Fatalf("expected 3 connections rejected by rate, got %d", a.RejectedRate)
+	}
+}
+
+func TestAdmissionRateCheckedLast(t *testing.T) {
+	a := NewAdmission()
+	a.MaxClients = 1
+	a.MaxClientsPerIP = 1
+	a.AcceptRate = 1
+	a.AcceptBurst = 2
+
+	first := connFrom("10.0.0.1")
+	if err := a.Admit(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// connections rejected by the other limits never take an accept token
+	for i := 0; i < 3; i++ {
+		if err := a.Admit(connFrom("10.0.0.2")); err != errMaxClients {
+			t.Fatalf("expected the max clients to be enforced, got %v", err)
+		}
+	}
+	a.MaxClients = 0
+	for i := 0; i < 3; i++ {
+		if err := a.Admit(connFrom("10.0.0.1")); err != errMaxClientsPerIP {
+			t.Fatalf("expected the per address limit to be enforced, got %v", err)
+		}
+	}
+
+	a.Release(first)
+	if err := a.Admit(connFrom("10.0.0.1")); err != nil {
+		t.Fatalf("expected the remaining token of the burst to be admitted, got %v", err)
+	} else if a.RejectedRate != 0 {
+		t.Fatalf("expected no connections rejected by rate, got %d", a.RejectedRate)
+	}
+}
+
+func TestAdmissionReject(t *testing.T) {
+	server, conn := net.Pipe()
+	go reject(server, errMaxClients)
+
+	client, _ := NewNetworkClient(conn)
+	defer client.Close()
+	expectError(t, client, errMaxClients.Error())
+	if _, err := client.ReadInterface(); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+// rejectingProtocol is a protocol replying to rejected connections in its own format
+type rejectingProtocol struct {
+	DefaultBroadcastServerProtocol
+}
+
+func (rejectingProtocol) RejectConnection(conn net.Conn, err error) {
+	conn.Write([]byte("rejected: " + err.Error() + "\n"))
+	conn.Close()
+}
+
+func TestAdmissionRejectByProtocol(t *testing.T) {
+	app := NewBroadcastServer()
+	l, err := app.AddNetListener(pipeListener{}, &rejectingProtocol{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, conn := net.Pipe()
+	go rejectConnection(l, server, errMaxClients)
+	b, _ := ioutil.ReadAll(conn)
+	if string(b) != "rejected: max number of clients reached\n" {
+		t.Fatalf("expected the protocol to reply to the rejected connection, got %q", b)
+	}
+}
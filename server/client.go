@@ -3,25 +3,47 @@ package server
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type ProtocolClient interface {
 	Close()
 	IsClosed() bool
+	Id() uint64
+	SetId(id uint64)
 	Address() string
 	WaitExit() chan struct{}
-
-	Initialize(conn *net.TCPConn, bufferSize int)
+	Context() context.Context
+	TLSState() *tls.ConnectionState
+	Identity() string
+	User() *User
+	SetUser(user *User)
+	Name() string
+	SetName(name string)
+	Protocol() string
+	SetProtocol(name string)
+	Touch(cmd string)
+	SetIdleTimeout(d time.Duration)
+	AddSubscriptions(n int) int
+	Info() ClientInfo
+
+	Initialize(conn net.Conn, bufferSize int)
+	SetLimits(limits ProtocolLimits)
+	LockWrites()
+	UnlockWrites()
 	Flush() error
 
+	Write(b []byte) (int, error)
 	WriteLen(prefix byte, n int) error
 	WriteString(s string) error
 	WriteByte(b byte) error
@@ -57,70 +79,170 @@ type BufferClient struct {
 
 	Reader *bufio.Reader
 	Writer *bufio.Writer
+	Limits ProtocolLimits // limits applied to the requests read
+	writes sync.Mutex     // held by whichever routine is writing to the client until it has flushed
 }
 
 type NetworkClient struct {
 	BufferClient
 
-	Addr         string        // remote address identifier
-	Closed       bool          // closed boolean identifier
-	Conn         *net.TCPConn  // network connection associated with this client
-	Quit         chan struct{} // channel for when the client exits
-	RequestError chan error    // channel for request errors
-}
-
-// Close will shutdown any latent network connections and clear the client out
-func (netClient NetworkClient) Close() {
+	id           uint64             // unique id assigned by the client registry
+	Addr         string             // remote address identifier
+	Closed       bool               // closed boolean identifier
+	Conn         net.Conn           // network connection associated with this client
+	TLS          tlsConnection      // tls connection associated with this client (if any)
+	Quit         chan struct{}      // channel for when the client exits
+	RequestError chan error         // channel for request errors
+	user         *User              // user the client has authenticated as
+	name         string             // name the client assigned to itself
+	protocol     string             // name of the protocol the client is speaking
+	stats        clientStats        // accounting of the client connection
+	idleTimeout  int64              // read idle timeout of the client in nanoseconds
+	ctx          context.Context    // context of the client, cancelled when the client is closed
+	cancel       context.CancelFunc // cancels the client context
+}
+
+// Close will shutdown any latent network connections and clear the client out, closing a
+// client more than once has no effect
+func (netClient *NetworkClient) Close() {
 	netClient.Lock()
 	defer netClient.Unlock()
 
-	if netClient.Conn == nil {
+	if netClient.Closed || netClient.Conn == nil {
 		return
 	}
 
 	netClient.Closed = true
+	netClient.cancel()
 	netClient.Conn.Close()
-	netClient.Conn = nil
-	close(netClient.RequestError)
 	close(netClient.Quit)
 }
 
-func (netClient NetworkClient) IsClosed() bool {
+func (netClient *NetworkClient) IsClosed() bool {
+	netClient.Lock()
+	defer netClient.Unlock()
 	return netClient.Closed
 }
 
-func (netClient NetworkClient) Address() string {
+// Id will return the unique id of the client (0 until the client is registered)
+func (netClient *NetworkClient) Id() uint64 {
+	return atomic.LoadUint64(&netClient.id)
+}
+
+// SetId will assign the unique id of the client
+func (netClient *NetworkClient) SetId(id uint64) {
+	atomic.StoreUint64(&netClient.id, id)
+}
+
+func (netClient *NetworkClient) Address() string {
 	return netClient.Addr
 }
 
-func (netClient NetworkClient) WaitExit() chan struct{} {
+func (netClient *NetworkClient) WaitExit() chan struct{} {
 	return netClient.Quit
 }
 
-func NewNetworkClient(conn *net.TCPConn) (*NetworkClient, error) {
+// Context will return the context of the client, it is cancelled when the client is closed
+func (netClient *NetworkClient) Context() context.Context {
+	return netClient.ctx
+}
+
+func NewNetworkClient(conn net.Conn) (*NetworkClient, error) {
 	c, err := NewNetworkClientSize(conn, 128)
 	return c, err
 }
 
-func NewNetworkClientSize(conn *net.TCPConn, bufferSize int) (*NetworkClient, error) {
+func NewNetworkClientSize(conn net.Conn, bufferSize int) (*NetworkClient, error) {
 	client := new(NetworkClient)
 	client.Initialize(conn, bufferSize)
 	return client, nil
 }
 
-func (client *NetworkClient) Initialize(conn *net.TCPConn, bufferSize int) {
+func (client *NetworkClient) Initialize(conn net.Conn, bufferSize int) {
 	client.Conn = conn
-	client.Reader = bufio.NewReaderSize(conn, bufferSize)
-	client.Writer = bufio.NewWriterSize(conn, bufferSize)
-	client.Addr = conn.RemoteAddr().String()
+	client.stats.created = time.Now()
+	client.stats.lastActive = client.stats.created.UnixNano()
+	client.Reader = bufio.NewReaderSize(clientReader{client}, bufferSize)
+	client.Writer = bufio.NewWriterSize(countingWriter{conn, &client.stats.bytesOut}, bufferSize)
+	client.Addr = remoteAddress(conn)
+	client.TLS, _ = conn.(tlsConnection)
 	client.Quit = make(chan struct{})
 	client.RequestError = make(chan error)
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+}
+
+// TLSState will return the state of the tls connection once the handshake has completed, or nil
+// when the client is not connected over tls
+func (client *NetworkClient) TLSState() *tls.ConnectionState {
+	if client.TLS == nil {
+		return nil
+	}
+
+	state := client.TLS.ConnectionState()
+	if !state.HandshakeComplete {
+		return nil
+	}
+	return &state
+}
+
+// Identity will return the subject common name of the verified client certificate, or an empty
+// string when the client has not presented a certificate that was verified by the server
+func (client *NetworkClient) Identity() string {
+	state := client.TLSState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
+
+// User will return the user the client has authenticated as (nil when not authenticated)
+func (client *NetworkClient) User() *User {
+	client.Lock()
+	defer client.Unlock()
+	return client.user
+}
+
+// SetUser will set the user the client has authenticated as
+func (client *NetworkClient) SetUser(user *User) {
+	client.Lock()
+	defer client.Unlock()
+	client.user = user
+}
+
+// anonymousClients is a sequence used to identify connections without a remote address
+var anonymousClients uint64
+
+// remoteAddress will return the remote address of the connection, connections that do not
+// have one (i.e. unix sockets) are identified by their local address and a sequence number
+func remoteAddress(conn net.Conn) string {
+	if addr := conn.RemoteAddr(); addr != nil && len(addr.String()) > 0 {
+		return addr.String()
+	}
+
+	local := ""
+	if addr := conn.LocalAddr(); addr != nil {
+		local = addr.String()
+	}
+	return local + "#" + strconv.FormatUint(atomic.AddUint64(&anonymousClients, 1), 10)
 }
 
 func (client *NetworkClient) RequestErrorChan() chan error {
 	return client.RequestError
 }
 
+// LockWrites will take the write lock of the client. Besides the routine serving the client, replies
+// are written by monitors, heartbeats and publishers from their own routines, so every writer holds
+// the lock from its first write until it has flushed to keep replies from interleaving.
+func (client *BufferClient) LockWrites() {
+	client.writes.Lock()
+}
+
+// UnlockWrites will release the write lock of the client
+func (client *BufferClient) UnlockWrites() {
+	client.writes.Unlock()
+}
+
 func (client *BufferClient) Flush() error {
 	return client.Writer.Flush()
 }
@@ -133,7 +255,7 @@ func (client *BufferClient) WriteLen(prefix byte, n int) error {
 	return err
 }
 
-/// WriteString will write the length of the string followed by the string data
+// WriteString will write the length of the string followed by the string data
 func (client *BufferClient) WriteString(s string) error {
 	client.Writer.WriteByte('+')
 	client.Writer.WriteString(s)
@@ -284,11 +406,12 @@ func (client *BufferClient) ReadPayload() ([]byte, error) {
 	n, err := client.ParseInt64(line[1:])
 	if err != nil {
 		return nil, err
+	} else if err := client.checkBulkLength(n); err != nil {
+		return nil, err
 	} else if n == -1 {
 		return nil, nil
 	} else {
-		buffer := make([]byte, n)
-		_, err := io.ReadFull(client.Reader, buffer)
+		buffer, err := client.readBulk(n)
 		if err != nil {
 			return nil, err
 		}
@@ -323,14 +446,19 @@ func (client *BufferClient) ReadBulkPayload() ([][]byte, error) {
 			n, err := client.ParseInt64(line[1:])
 			if err != nil {
 				return nil, err
+			} else if err := client.checkArrayLength(n); err != nil {
+				return nil, err
+			} else if n < 0 {
+				return nil, errReadRequest
 			}
 
-			r := make([][]byte, n)
-			for i := range r {
-				r[i], err = client.ReadPayload()
+			r := make([][]byte, 0, arrayCapacity(n))
+			for i := int64(0); i < n; i++ {
+				payload, err := client.ReadPayload()
 				if err != nil {
 					return nil, err
 				}
+				r = append(r, payload)
 			}
 
 			return r, nil
@@ -347,6 +475,11 @@ func (client *BufferClient) ReadBulkPayload() ([][]byte, error) {
 // is the generic use case implemented for broadcast-clients when needing to return
 // errors, integers or payloads that aren't in the pure form of bytes for easy interpretation.
 func (client *BufferClient) ReadInterface() (interface{}, error) {
+	return client.readInterface(0)
+}
+
+// readInterface will read an interface payload nested within the given depth of arrays
+func (client *BufferClient) readInterface(depth int) (interface{}, error) {
 	// read a line off of the client as we are provided a new transmission
 	line, err := client.ReadLine()
 	if err != nil {
@@ -361,11 +494,12 @@ func (client *BufferClient) ReadInterface() (interface{}, error) {
 			n, err := client.ParseInt64(line[1:])
 			if err != nil {
 				return nil, err
+			} else if err := client.checkBulkLength(n); err != nil {
+				return nil, err
 			} else if n == -1 {
 				return nil, nil
 			} else {
-				buffer := make([]byte, n)
-				_, err := io.ReadFull(client.Reader, buffer)
+				buffer, err := client.readBulk(n)
 				if err != nil {
 					return nil, err
 				}
@@ -384,14 +518,21 @@ func (client *BufferClient) ReadInterface() (interface{}, error) {
 			n, err := client.ParseInt64(line[1:])
 			if err != nil {
 				return nil, err
+			} else if err := client.checkArrayLength(n); err != nil {
+				return nil, err
+			} else if err := client.checkDepth(depth + 1); err != nil {
+				return nil, err
+			} else if n == -1 {
+				return nil, nil
 			}
 
-			r := make([]interface{}, n)
-			for i := range r {
-				r[i], err = client.ReadInterface()
+			r := make([]interface{}, 0, arrayCapacity(n))
+			for i := int64(0); i < n; i++ {
+				v, err := client.readInterface(depth + 1)
 				if err != nil {
 					return nil, err
 				}
+				r = append(r, v)
 			}
 
 			return r, nil
@@ -415,14 +556,18 @@ func (client *BufferClient) ReadInterface() (interface{}, error) {
 				return nil, err
 			}
 
-			r, err := client.ReadInterface()
+			if err := client.checkDepth(depth + 1); err != nil {
+				return nil, err
+			}
+
+			r, err := client.readInterface(depth + 1)
 			if err != nil {
 				return nil, err
 			}
 
-			if structure == "json" {
+			if b, ok := r.([]byte); ok && structure == "json" {
 				var result map[string]interface{}
-				err := json.Unmarshal(r.([]byte), &result)
+				err := json.Unmarshal(b, &result)
 				if err != nil {
 					return nil, err
 				}
@@ -477,7 +622,7 @@ func (client *BufferClient) ParseError(b []byte) (error, error) {
 }
 
 func (client *BufferClient) ReadLine() ([]byte, error) {
-	packet, err := client.Reader.ReadSlice('\n')
+	packet, err := client.readLine()
 	if err != nil {
 		return nil, err
 	}
@@ -491,7 +636,7 @@ func (client *BufferClient) ReadLine() ([]byte, error) {
 }
 
 func (client *BufferClient) ReadLineInvariant() ([]byte, error) {
-	packet, err := client.Reader.ReadSlice('\n')
+	packet, err := client.readLine()
 	if err != nil {
 		return nil, err
 	}
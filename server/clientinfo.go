@@ -0,0 +1,175 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ClientInfo is a point in time snapshot of a client connection and its accounting
+type ClientInfo struct {
+	Id            uint64        // unique id of the client
+	Addr          string        // remote address of the client
+	Name          string        // name the client assigned to itself (CLIENT SETNAME)
+	Protocol      string        // name of the protocol the client is speaking
+	User          string        // name of the user the client is authenticated as
+	Age           time.Duration // time since the client connected
+	Idle          time.Duration // time since the client last ran a command
+	LastCommand   string        // last command the client ran
+	Commands      int64         // number of commands processed
+	BytesIn       int64         // number of bytes read from the client
+	BytesOut      int64         // number of bytes written to the client
+	Subscriptions int           // number of topics the client is subscribed to
+}
+
+// String will format the client info as a single line of space separated key=value pairs
+func (info ClientInfo) String() string {
+	return fmt.Sprintf("id=%d addr=%s name=%s age=%d idle=%d proto=%s user=%s cmd=%s cmds=%d in=%d out=%d sub=%d",
+		info.Id, info.Addr, info.Name, int64(info.Age.Seconds()), int64(info.Idle.Seconds()), info.Protocol,
+		info.User, strings.ToLower(info.LastCommand), info.Commands, info.BytesIn, info.BytesOut, info.Subscriptions)
+}
+
+// clientStats is the accounting kept for every network client
+type clientStats struct {
+	created       time.Time // time the client connected
+	lastActive    int64     // unix nano timestamp of the last command
+	lastCommand   string    // last command processed
+	commands      int64     // number of commands processed
+	bytesIn       int64     // number of bytes read
+	bytesOut      int64     // number of bytes written
+	subscriptions int64     // number of subscribed topics
+}
+
+// clientReader counts the bytes read from the client connection and applies the read idle
+// timeout of the client, clients that are subscribed to topics are exempt from the timeout
+type clientReader struct {
+	client *NetworkClient
+}
+
+func (r clientReader) Read(p []byte) (int, error) {
+	client := r.client
+	if atomic.LoadInt64(&client.idleTimeout) > 0 {
+		client.armReadDeadline()
+	}
+
+	n, err := client.Conn.Read(p)
+	atomic.AddInt64(&client.stats.bytesIn, int64(n))
+	if errors.Is(err, os.ErrDeadlineExceeded) && atomic.LoadInt64(&client.idleTimeout) > 0 {
+		// close through the normal exit path so that the client is unregistered
+		client.Close()
+		return n, errIdleTimeout
+	}
+	return n, err
+}
+
+// countingWriter will count the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// SetIdleTimeout will close the client once it has not sent anything for the given duration,
+// clients subscribed to topics are exempt (0 for no timeout)
+func (client *NetworkClient) SetIdleTimeout(d time.Duration) {
+	atomic.StoreInt64(&client.idleTimeout, int64(d))
+	client.armReadDeadline()
+}
+
+// armReadDeadline will set the read deadline of the connection from the idle timeout, or clear it
+// when there is no timeout or the client is subscribed to topics. A read may already be waiting on
+// the connection (requests are read ahead), so the deadline is changed whenever the timeout or the
+// subscriptions change rather than only before each read.
+func (client *NetworkClient) armReadDeadline() {
+	client.Lock()
+	defer client.Unlock()
+	if client.Conn == nil {
+		return
+	}
+
+	idle := time.Duration(atomic.LoadInt64(&client.idleTimeout))
+	if idle > 0 && atomic.LoadInt64(&client.stats.subscriptions) == 0 {
+		client.Conn.SetReadDeadline(time.Now().Add(idle))
+	} else {
+		client.Conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// Name will return the name the client assigned to itself
+func (client *NetworkClient) Name() string {
+	client.Lock()
+	defer client.Unlock()
+	return client.name
+}
+
+// SetName will assign a name to the client
+func (client *NetworkClient) SetName(name string) {
+	client.Lock()
+	defer client.Unlock()
+	client.name = name
+}
+
+// Protocol will return the name of the protocol the client is speaking
+func (client *NetworkClient) Protocol() string {
+	client.Lock()
+	defer client.Unlock()
+	return client.protocol
+}
+
+// SetProtocol will set the name of the protocol the client is speaking
+func (client *NetworkClient) SetProtocol(name string) {
+	client.Lock()
+	defer client.Unlock()
+	client.protocol = name
+}
+
+// Touch will record that the client has processed the given command
+func (client *NetworkClient) Touch(cmd string) {
+	atomic.AddInt64(&client.stats.commands, 1)
+	atomic.StoreInt64(&client.stats.lastActive, time.Now().UnixNano())
+	client.Lock()
+	client.stats.lastCommand = cmd
+	client.Unlock()
+}
+
+// AddSubscriptions will adjust the number of topics the client is subscribed to, returning the new count
+func (client *NetworkClient) AddSubscriptions(n int) int {
+	count := atomic.AddInt64(&client.stats.subscriptions, int64(n))
+	if atomic.LoadInt64(&client.idleTimeout) > 0 {
+		client.armReadDeadline()
+	}
+	return int(count)
+}
+
+// Info will return a snapshot of the client and its accounting
+func (client *NetworkClient) Info() ClientInfo {
+	now := time.Now()
+	info := ClientInfo{}
+	info.Id = client.Id()
+	info.Addr = client.Address()
+	info.Age = now.Sub(client.stats.created)
+	info.Idle = now.Sub(time.Unix(0, atomic.LoadInt64(&client.stats.lastActive)))
+	info.Commands = atomic.LoadInt64(&client.stats.commands)
+	info.BytesIn = atomic.LoadInt64(&client.stats.bytesIn)
+	info.BytesOut = atomic.LoadInt64(&client.stats.bytesOut)
+	info.Subscriptions = int(atomic.LoadInt64(&client.stats.subscriptions))
+
+	client.Lock()
+	info.Name = client.name
+	info.Protocol = client.protocol
+	info.LastCommand = client.stats.lastCommand
+	if client.user != nil {
+		info.User = client.user.Name
+	}
+	client.Unlock()
+	return info
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the latency histogram kept for every command, calls
+// slower than the last bound are counted in a final overflow bucket
+var LatencyBuckets = []time.Duration{
+	10 * time.Microsecond, 25 * time.Microsecond, 50 * time.Microsecond, 100 * time.Microsecond,
+	250 * time.Microsecond, 500 * time.Microsecond, time.Millisecond, 2500 * time.Microsecond,
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second,
+}
+
+// CommandStat is the accounting of a single command since the server started
+type CommandStat struct {
+	Calls       int64   // number of times the command was dispatched
+	Errors      int64   // number of calls that failed with an error
+	Usec        int64   // total time spent in the command in microseconds
+	UsecPerCall float64 // average time spent per call in microseconds
+	Latency     []int64 // number of calls within each of the latency buckets followed by the overflow
+}
+
+// commandCounters are the counters of a single command, updated atomically
+type commandCounters struct {
+	calls   int64
+	errors  int64
+	nanos   int64
+	buckets []int64
+}
+
+// CommandStats keeps the call counts, error counts, total time and latency histogram of every
+// command dispatched through the server
+type CommandStats struct {
+	sync.RWMutex
+
+	commands map[string]*commandCounters
+}
+
+// NewCommandStats will create the accounting of a server that has not dispatched any commands
+func NewCommandStats() *CommandStats {
+	stats := new(CommandStats)
+	stats.commands = make(map[string]*commandCounters)
+	return stats
+}
+
+// counters will return the counters of the command, creating them if necessary
+func (stats *CommandStats) counters(cmd string) *commandCounters {
+	stats.RLock()
+	c, ok := stats.commands[cmd]
+	stats.RUnlock()
+	if ok {
+		return c
+	}
+
+	stats.Lock()
+	defer stats.Unlock()
+	if c, ok = stats.commands[cmd]; !ok {
+		c = &commandCounters{buckets: make([]int64, len(LatencyBuckets)+1)}
+		stats.commands[cmd] = c
+	}
+	return c
+}
+
+// Record will account for a single call of the command that took d to run
+func (stats *CommandStats) Record(cmd string, d time.Duration, err error) {
+	c := stats.counters(cmd)
+	atomic.AddInt64(&c.calls, 1)
+	atomic.AddInt64(&c.nanos, int64(d))
+	if err != nil {
+		atomic.AddInt64(&c.errors, 1)
+	}
+
+	i := 0
+	for i < len(LatencyBuckets) && d > LatencyBuckets[i] {
+		i++
+	}
+	atomic.AddInt64(&c.buckets[i], 1)
+}
+
+// Snapshot will return the accounting of every command that has been dispatched
+func (stats *CommandStats) Snapshot() map[string]CommandStat {
+	stats.RLock()
+	defer stats.RUnlock()
+	snapshot := make(map[string]CommandStat, len(stats.commands))
+	for cmd, c := range stats.commands {
+		stat := CommandStat{Calls: atomic.LoadInt64(&c.calls), Errors: atomic.LoadInt64(&c.errors)}
+		stat.Usec = atomic.LoadInt64(&c.nanos) / int64(time.Microsecond)
+		if stat.Calls > 0 {
+			stat.UsecPerCall = float64(stat.Usec) / float64(stat.Calls)
+		}
+		stat.Latency = make([]int64, len(c.buckets))
+		for i := range c.buckets {
+			stat.Latency[i] = atomic.LoadInt64(&c.buckets[i])
+		}
+		snapshot[cmd] = stat
+	}
+	return snapshot
+}
+
+// stats is the middleware that accounts for the calls, errors and latency of every registered command
+func (ctx *BroadcastContext) stats(c context.Context, cmd string, data interface{}, client ProtocolClient, next Dispatcher) error {
+	if _, ok := ctx.Commands[cmd]; !ok {
+		return next(c, cmd, data, client)
+	}
+
+	start := time.Now()
+	err := next(c, cmd, data, client)
+	ctx.CommandStats.Record(cmd, time.Since(start), err)
+	return err
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCommandStatsLatency(t *testing.T) {
+	stats := NewCommandStats()
+	stats.Record("GET", 5*time.Microsecond, nil)
+	stats.Record("GET", 10*time.Microsecond, nil)
+	stats.Record("GET", 11*time.Microsecond, errors.New("failed"))
+	stats.Record("GET", 2*time.Second, nil)
+
+	stat := stats.Snapshot()["GET"]
+	if stat.Calls != 4 || stat.Errors != 1 {
+		t.Fatalf("expected 4 calls and 1 error, got %d calls and %d errors", stat.Calls, stat.Errors)
+	} else if stat.Usec != 2000026 || stat.UsecPerCall != 500006.5 {
+		t.Fatalf("expected the total and average time of the calls, got %d and %g", stat.Usec, stat.UsecPerCall)
+	}
+
+	// bounds are inclusive and calls beyond the last bound are counted in the overflow bucket
+	expected := make([]int64, len(LatencyBuckets)+1)
+	expected[0], expected[1], expected[len(LatencyBuckets)] = 2, 1, 1
+	for i, n := range stat.Latency {
+		if n != expected[i] {
+			t.Fatalf("expected latency buckets %v, got %v", expected, stat.Latency)
+		}
+	}
+}
+
+func TestCommandStatsMiddleware(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	client := connect(t, app, l)
+
+	send(client, []string{"SETK", "a", "1"}, []string{"GETK", "a"}, []string{"GETK"}, []string{"NOPE"})
+	expect(t, client, "OK")
+	expect(t, client, "1")
+	reply(t, client)
+	reply(t, client)
+
+	snapshot := app.ctx.CommandStats.Snapshot()
+	if stat := snapshot["SETK"]; stat.Calls != 1 || stat.Errors != 0 {
+		t.Fatalf("expected 1 call of SETK, got %+v", stat)
+	} else if stat := snapshot["GETK"]; stat.Calls != 2 || stat.Errors != 1 {
+		t.Fatalf("expected 2 calls of GETK with 1 error, got %+v", stat)
+	} else if _, ok := snapshot["NOPE"]; ok {
+		t.Fatal("expected unknown commands not to be accounted for")
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// CommandFlags describe the behaviour of a command (i.e. readonly, write)
+type CommandFlags uint
+
+const (
+	FlagReadOnly    CommandFlags = 1 << iota // command only reads data
+	FlagWrite                                // command modifies data
+	FlagAdmin                                // command administers the server or its connections
+	FlagPubSub                               // command publishes or subscribes to topics
+	FlagBlocking                             // command streams replies to the client until it disconnects
+	FlagDirect                               // command writes its replies straight to the connection (i.e. it may close the connection once it has replied)
+	FlagTransaction                          // command controls a transaction (MULTI, EXEC, DISCARD, WATCH, UNWATCH)
+)
+
+var flagNames = []string{"readonly", "write", "admin", "pubsub", "blocking", "direct", "transaction"}
+
+// flagCategories are the access control categories commands are added to by their flags
+var flagCategories = map[CommandFlags]string{FlagReadOnly: "read", FlagWrite: "write", FlagAdmin: "admin", FlagPubSub: "pubsub", FlagTransaction: "transaction"}
+
+// Has will determine whether all of the given flags are set
+func (f CommandFlags) Has(flags CommandFlags) bool {
+	return f&flags == flags
+}
+
+// Strings will return the names of the flags that are set
+func (f CommandFlags) Strings() []string {
+	names := make([]string, 0)
+	for i, name := range flagNames {
+		if f.Has(1 << uint(i)) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// MarshalJSON will marshal the flags as the list of their names
+func (f CommandFlags) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Strings())
+}
+
+// ArgType is the type of value expected for an argument of a command
+type ArgType string
+
+const (
+	ArgKey     ArgType = "key"     // name of a key
+	ArgString  ArgType = "string"  // any value
+	ArgInteger ArgType = "integer" // 64-bit signed integer
+	ArgFloat   ArgType = "float"   // 64-bit floating point number
+)
+
+// Variadic is the maximum number of arguments of commands that accept any number of arguments
+const Variadic = -1
+
+// Command describes a command handler with name, description, usage and the arguments it accepts.
+// Commands declaring any arity, flags, keys or argument types have their arguments validated before
+// they are dispatched, commands without declarations are passed their arguments as they are.
+type Command struct {
+	Name        string       // name of the command
+	Description string       // description of the command
+	Usage       string       // example usage of the command
+	FireForget  bool         // true to ignore responses, false to wait for a response
+	MinArgs     int          // minimum number of arguments
+	MaxArgs     int          // maximum number of arguments (Variadic for any number)
+	Flags       CommandFlags // behaviour of the command (i.e. readonly, write)
+	FirstKey    int          // position of the first key argument (1 based, 0 for none)
+	LastKey     int          // position of the last key argument (negative counts from the last argument)
+	KeyStep     int          // step between key arguments (i.e. 2 for key value pairs)
+	Args        []ArgType    // types of the arguments, the last type applies to any remaining arguments
+}
+
+// Declared will determine whether the command declares the arguments it accepts
+func (cmd Command) Declared() bool {
+	return cmd.MinArgs > 0 || cmd.MaxArgs != 0 || cmd.Flags != 0 || cmd.FirstKey > 0 || len(cmd.Args) > 0
+}
+
+// ArgType will return the declared type of the argument at the given index (0 based)
+func (cmd Command) ArgType(i int) ArgType {
+	if len(cmd.Args) == 0 {
+		return ArgString
+	} else if i >= len(cmd.Args) {
+		return cmd.Args[len(cmd.Args)-1]
+	}
+	return cmd.Args[i]
+}
+
+// KeyIndexes will return the indexes (0 based) of the key arguments given the number of arguments
+func (cmd Command) KeyIndexes(n int) []int {
+	if cmd.FirstKey <= 0 {
+		return nil
+	}
+
+	last := cmd.LastKey
+	if last < 0 {
+		last = n + last + 1
+	} else if last == 0 {
+		last = cmd.FirstKey
+	}
+
+	step := cmd.KeyStep
+	if step <= 0 {
+		step = 1
+	}
+
+	indexes := make([]int, 0)
+	for i := cmd.FirstKey; i <= last && i <= n; i += step {
+		indexes = append(indexes, i-1)
+	}
+	return indexes
+}
+
+// Validate will ensure the arguments are within the declared arity and of the declared types
+func (cmd Command) Validate(data interface{}) error {
+	if !cmd.Declared() {
+		return nil
+	}
+
+	args := argList(data)
+
+	n := len(args)
+	if n < cmd.MinArgs || (cmd.MaxArgs != Variadic && n > cmd.MaxArgs) {
+		if len(cmd.Usage) > 0 {
+			return fmt.Errorf("wrong number of arguments for '%s' command (usage: %s)", cmd.Name, cmd.Usage)
+		}
+		return fmt.Errorf("wrong number of arguments for '%s' command", cmd.Name)
+	}
+
+	for i, arg := range args {
+		t := cmd.ArgType(i)
+		if !validArg(t, arg) {
+			return fmt.Errorf("argument %d of '%s' command is not a valid %s", i+1, cmd.Name, t)
+		}
+	}
+
+	return nil
+}
+
+// redactedCommands are the commands whose arguments (i.e. passwords) are replaced with redacted
+// wherever commands are recorded or shown (slow log, MONITOR)
+var redactedCommands = map[string]bool{"AUTH": true}
+
+// redacted replaces the arguments of redacted commands
+const redacted = "(redacted)"
+
+// argList will return the arguments as they were read by any protocol ([][]byte or []interface{})
+// as a list of values
+func argList(data interface{}) []interface{} {
+	switch d := data.(type) {
+	case [][]byte:
+		args := make([]interface{}, len(d))
+		for i, v := range d {
+			args[i] = v
+		}
+		return args
+	case []interface{}:
+		return d
+	}
+	return nil
+}
+
+// validArg will determine whether the argument is a valid value of the given type
+func validArg(t ArgType, arg interface{}) bool {
+	switch t {
+	case ArgInteger:
+		switch v := arg.(type) {
+		case int64, int:
+			return true
+		case []byte:
+			_, err := strconv.ParseInt(string(v), 10, 64)
+			return err == nil
+		case string:
+			_, err := strconv.ParseInt(v, 10, 64)
+			return err == nil
+		}
+		return false
+	case ArgFloat:
+		switch v := arg.(type) {
+		case float64, int64, int:
+			return true
+		case []byte:
+			_, err := strconv.ParseFloat(string(v), 64)
+			return err == nil
+		case string:
+			_, err := strconv.ParseFloat(v, 64)
+			return err == nil
+		}
+		return false
+	}
+
+	return true
+}
@@ -1,13 +1,40 @@
 package server
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // error constants associated with the broadcast server
 var errLineFormat = errors.New("bad response line format")
 var errReadRequest = errors.New("invalid request protocol")
 var errBadBulkFormat = errors.New("bad bulk string format")
-var errCmdNotFound = errors.New("invalid command format")
-var errQuit = errors.New("client quit")
+var errShuttingDown = errors.New("SHUTDOWN server is shutting down")
+var errIdleTimeout = errors.New("client idle timeout")
+var errInternal = errors.New("internal error")
+
+// ErrCmdNotFound is returned when a command is dispatched that has not been registered
+var ErrCmdNotFound = errors.New("invalid command format")
+
+// ErrQuit is returned by Serve once the client has sent the QUIT command
+var ErrQuit = errors.New("client quit")
+
+// pipelineDepth is the number of requests read ahead of their execution and the largest batch
+var pipelineDepth = 128
+
+// slowLogThreshold is the time commands must run for to be recorded in the slow log by default
+var slowLogThreshold = 10 * time.Millisecond
+
+// slowLogMaxLen is the number of entries kept in the slow log by default
+var slowLogMaxLen = 128
+
+// monitorBufferSize is the number of lines buffered for each monitor before lines are dropped
+var monitorBufferSize = 1024
+
+var tlsHandshakeTimeout = 10 * time.Second
+
+// logBufferSize is the number of log entries buffered before entries are dropped
+var logBufferSize = 4096
 
 var Delims = []byte("\r\n")
 var NullBulk = []byte("-1")
@@ -1,31 +1,108 @@
 package server
 
 import (
+	"context"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type BroadcastContext struct {
-	Commands    map[string]Handler  // commands is a map of all the available commands executable by the server
-	CommandHelp map[string]Command  // command help includes name, description and usage
-	Events      chan BroadcastEvent // events for the context of the broadcast server
-	ClientSize  int                 // number of connected clients
+	Commands     map[string]ContextHandler // commands is a map of all the available commands executable by the server
+	CommandHelp  map[string]Command        // command help includes name, description and usage
+	Log          *Logger                   // structured logger of the broadcast server
+	ACL          *ACL                      // access control list of users and command categories
+	middleware   []Middleware              // middleware wrapping the dispatch of every command
+	dispatch     Dispatcher                // dispatch pipeline built from the middleware
+	base         context.Context           // base context of every request, cancelled when the server closes
+	cancel       context.CancelFunc        // cancels the base context
+	timeoutLock  sync.RWMutex              // guards the command deadlines
+	timeout      time.Duration             // default deadline of every command (0 for none)
+	timeouts     map[string]time.Duration  // deadlines of individual commands
+	requestLock  sync.Mutex                // guards the in-flight request state
+	inflight     int                       // number of commands currently being dispatched
+	replying     int                       // number of replies not yet flushed to their clients
+	draining     bool                      // true once no new commands should be dispatched
+	drained      chan struct{}             // closed once draining and no commands or replies are pending
+	Clients      *ClientRegistry           // registry of the connected clients
+	Admission    *Admission                // admission control of incoming connections
+	RateLimiter  *RateLimiter              // rate limits of commands and categories
+	Transactions *Transactions             // MULTI/EXEC transactions and watched keys of every client
+	SlowLog      *SlowLog                  // commands that took longer than the slow log threshold to run
+	Monitors     *Monitors                 // clients streaming every command executed (MONITOR)
+	CommandStats *CommandStats             // calls, errors and latency of every command
+	Limits       ProtocolLimits            // limits of the requests read from clients
 }
 
 // RegisterCommand takes a simple command structure and handler to assign both the help info and the handler itself
 func (ctx *BroadcastContext) RegisterCommand(cmd Command, handler Handler) {
 	ctx.Register(cmd.Name, handler)
-	ctx.CommandHelp[strings.ToUpper(cmd.Name)] = cmd
+	ctx.RegisterHelp(cmd)
 }
 
 // Register will bind a particular byte/mark to a specific command handler (thus registering command handlers)
 func (ctx *BroadcastContext) Register(cmd string, handler Handler) {
+	ctx.RegisterContext(cmd, AdaptHandler(handler))
+}
+
+// RegisterContextCommand takes a simple command structure and context aware handler to assign both the help info and the handler itself
+func (ctx *BroadcastContext) RegisterContextCommand(cmd Command, handler ContextHandler) {
+	ctx.RegisterContext(cmd.Name, handler)
+	ctx.RegisterHelp(cmd)
+}
+
+// RegisterContext will bind a command to a context aware handler
+func (ctx *BroadcastContext) RegisterContext(cmd string, handler ContextHandler) {
 	ctx.Commands[strings.ToUpper(cmd)] = handler
 }
 
-// RegisterHelp will only register that the command exists in some form (without a handler which may be processed another way)
+// RegisterHelp will only register that the command exists in some form (without a handler which may be processed another way),
+// the command is added to the access control categories of its flags (i.e. readonly commands to the read category)
 func (ctx *BroadcastContext) RegisterHelp(cmd Command) {
-	ctx.CommandHelp[strings.ToUpper(cmd.Name)] = cmd
+	name := strings.ToUpper(cmd.Name)
+	ctx.CommandHelp[name] = cmd
+	for flag, category := range flagCategories {
+		if cmd.Flags.Has(flag) {
+			ctx.RegisterCategory(category, name)
+		}
+	}
+}
+
+// RegisterCategory will add the given commands to an access control category (i.e. read, write, admin)
+func (ctx *BroadcastContext) RegisterCategory(category string, cmds ...string) {
+	ctx.ACL.RegisterCategory(category, cmds...)
+}
+
+// Authorize will determine whether the client is permitted to run the given command
+func (ctx *BroadcastContext) Authorize(cmd string, client ProtocolClient) error {
+	return ctx.ACL.Authorize(cmd, client)
+}
+
+// authorize is the middleware that rejects commands the client is not permitted to run
+func (ctx *BroadcastContext) authorize(c context.Context, cmd string, data interface{}, client ProtocolClient, next Dispatcher) error {
+	if err := ctx.Authorize(cmd, client); err != nil {
+		return err
+	}
+
+	return next(c, cmd, data, client)
+}
+
+// validate is the middleware that rejects commands with arguments that do not match their declarations
+func (ctx *BroadcastContext) validate(c context.Context, cmd string, data interface{}, client ProtocolClient, next Dispatcher) error {
+	if help, ok := ctx.CommandHelp[cmd]; ok {
+		if err := help.Validate(data); err != nil {
+			return err
+		}
+	}
+
+	return next(c, cmd, data, client)
+}
+
+// Context will return the base context of every request, it is cancelled when the server closes
+func (ctx *BroadcastContext) Context() context.Context {
+	return ctx.base
 }
 
 func (ctx *BroadcastContext) Help() (map[string]Command, error) {
@@ -38,16 +115,49 @@ func (ctx *BroadcastContext) Status() (*BroadcastServerStatus, error) {
 	status.NumGoroutines = runtime.NumGoroutine()
 	status.NumCpu = runtime.NumCPU()
 	status.NumCgoCall = runtime.NumCgoCall()
-	status.NumClients = ctx.ClientSize
+	status.NumClients = ctx.Clients.Len()
+	status.NumMonitors = ctx.Monitors.Len()
+	status.NumInFlight = ctx.InFlight()
+	status.MaxClients = ctx.Admission.MaxClients
+	status.NumAccepted = atomic.LoadInt64(&ctx.Admission.Accepted)
+	status.NumRejected = ctx.Admission.Rejected()
+	status.NumRejectedMaxClients = atomic.LoadInt64(&ctx.Admission.RejectedMaxClients)
+	status.NumRejectedPerIP = atomic.LoadInt64(&ctx.Admission.RejectedPerIP)
+	status.NumRejectedRate = atomic.LoadInt64(&ctx.Admission.RejectedRate)
+	status.NumRateLimited, status.NumRateDropped, status.RateLimitHits = ctx.RateLimiter.Stats()
 	status.Memory = new(runtime.MemStats)
 	runtime.ReadMemStats(status.Memory)
+	status.Commands = ctx.CommandStats.Snapshot()
 	return status, nil
 }
 
 func NewBroadcastContext() *BroadcastContext {
 	ctx := new(BroadcastContext)
-	ctx.Commands = make(map[string]Handler)
+	ctx.Commands = make(map[string]ContextHandler)
 	ctx.CommandHelp = make(map[string]Command)
-	ctx.Events = make(chan BroadcastEvent)
+	ctx.Log = NewLogger(LevelInfo, logBufferSize)
+	ctx.Clients = NewClientRegistry()
+	ctx.Admission = NewAdmission()
+	ctx.RateLimiter = NewRateLimiter()
+	ctx.Transactions = NewTransactions()
+	ctx.SlowLog = NewSlowLog(slowLogThreshold, slowLogMaxLen)
+	ctx.Monitors = NewMonitors()
+	ctx.CommandStats = NewCommandStats()
+	ctx.Limits = DefaultProtocolLimits()
+	ctx.ACL = NewACL()
+	ctx.base, ctx.cancel = context.WithCancel(context.Background())
+	ctx.timeouts = make(map[string]time.Duration)
+	ctx.middleware = make([]Middleware, 0)
+	ctx.Use(ctx.multi)
+	ctx.Use(ctx.stats)
+	ctx.Use(ctx.authorize)
+	ctx.Use(ctx.validate)
+	ctx.Use(ctx.ratelimit)
+	ctx.Use(ctx.monitor)
+	ctx.Use(ctx.atomic)
+	ctx.Use(ctx.slowlog)
+	ctx.registerTransactions()
+	ctx.RegisterContextCommand(Command{Name: "MONITOR", Description: "Streams every command executed by the server until the connection is closed", Usage: "MONITOR",
+		Flags: FlagAdmin | FlagBlocking}, ctx.monitorCmd)
 	return ctx
 }
@@ -1,12 +1,17 @@
 package server
 
+import "context"
+
 // Handler is the actual function declaration that is provided argument data, client, and server
 type Handler func(interface{}, ProtocolClient) error
 
-// Command describes a command handler with name, description, usage
-type Command struct {
-	Name        string // name of the command
-	Description string // description of the command
-	Usage       string // example usage of the command
-	FireForget  bool   // true to ignore responses, false to wait for a response
+// ContextHandler is a handler that is also provided the context of the request, the context is
+// cancelled when the client disconnects, when the server closes or when the command's deadline passes
+type ContextHandler func(context.Context, interface{}, ProtocolClient) error
+
+// AdaptHandler will adapt a handler without a context so it can be called as a context handler
+func AdaptHandler(handler Handler) ContextHandler {
+	return func(c context.Context, data interface{}, client ProtocolClient) error {
+		return handler(data, client)
+	}
 }
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// bulkChunkSize is the size of bulk payloads read at once, larger payloads are read into a buffer
+// that grows as the data arrives rather than being allocated up front from their declared length
+const bulkChunkSize = 64 * 1024
+
+// arrayChunkSize is the number of array elements allocated up front, larger arrays grow as their
+// elements are read rather than being allocated from their declared length
+const arrayChunkSize = 1024
+
+// ProtocolLimits bound the size of the requests read from clients so that a peer cannot make the
+// server allocate arbitrary amounts of memory (0 for no limit)
+type ProtocolLimits struct {
+	MaxBulkLength  int64 // maximum length of a bulk payload in bytes
+	MaxArrayLength int64 // maximum number of elements of an array
+	MaxDepth       int   // maximum nesting depth of arrays
+	MaxLineLength  int   // maximum length of a single line in bytes
+}
+
+// DefaultProtocolLimits will return the limits applied to server connections by default
+func DefaultProtocolLimits() ProtocolLimits {
+	return ProtocolLimits{
+		MaxBulkLength:  16 * 1024 * 1024,
+		MaxArrayLength: 1024 * 1024,
+		MaxDepth:       32,
+		MaxLineLength:  64 * 1024,
+	}
+}
+
+// LimitError is returned when a request exceeds the protocol limits of the client, the connection
+// should be closed as the remainder of the request cannot be read reliably
+type LimitError struct {
+	Limit string // name of the limit that was exceeded
+	Size  int64  // size of the request
+	Max   int64  // maximum size permitted
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Protocol error: %s of %d exceeds the limit of %d", e.Limit, e.Size, e.Max)
+}
+
+// SetLimits will set the protocol limits applied to requests read by the client
+func (client *BufferClient) SetLimits(limits ProtocolLimits) {
+	client.Limits = limits
+}
+
+// checkBulkLength will ensure the length of a bulk payload is within the limits
+func (client *BufferClient) checkBulkLength(n int64) error {
+	if n < -1 {
+		return errReadRequest
+	} else if client.Limits.MaxBulkLength > 0 && n > client.Limits.MaxBulkLength {
+		return &LimitError{Limit: "bulk length", Size: n, Max: client.Limits.MaxBulkLength}
+	}
+	return nil
+}
+
+// checkArrayLength will ensure the number of elements of an array is within the limits
+func (client *BufferClient) checkArrayLength(n int64) error {
+	if n < -1 {
+		return errReadRequest
+	} else if client.Limits.MaxArrayLength > 0 && n > client.Limits.MaxArrayLength {
+		return &LimitError{Limit: "array length", Size: n, Max: client.Limits.MaxArrayLength}
+	}
+	return nil
+}
+
+// arrayCapacity will return the capacity to allocate up front for an array of n elements
+func arrayCapacity(n int64) int {
+	if n > arrayChunkSize {
+		return arrayChunkSize
+	}
+	return int(n)
+}
+
+// checkDepth will ensure the nesting depth of arrays is within the limits
+func (client *BufferClient) checkDepth(depth int) error {
+	if client.Limits.MaxDepth > 0 && depth > client.Limits.MaxDepth {
+		return &LimitError{Limit: "nesting depth", Size: int64(depth), Max: int64(client.Limits.MaxDepth)}
+	}
+	return nil
+}
+
+// readBulk will read a bulk payload of n bytes, payloads larger than a chunk are read into a buffer
+// that grows as the data actually arrives so that a peer declaring a large length without sending
+// the data cannot make the server allocate it
+func (client *BufferClient) readBulk(n int64) ([]byte, error) {
+	if n <= bulkChunkSize {
+		buffer := make([]byte, n)
+		_, err := io.ReadFull(client.Reader, buffer)
+		return buffer, err
+	}
+
+	var buffer bytes.Buffer
+	buffer.Grow(bulkChunkSize)
+	if _, err := io.CopyN(&buffer, client.Reader, n); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// readLine will read up to and including the next newline, lines longer than the buffer of the
+// reader are accumulated until the line length limit is exceeded
+func (client *BufferClient) readLine() ([]byte, error) {
+	max := client.Limits.MaxLineLength
+	packet, err := client.Reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		line := append([]byte(nil), packet...)
+		for err == bufio.ErrBufferFull {
+			if max > 0 && len(line) > max+2 {
+				return nil, &LimitError{Limit: "line length", Size: int64(len(line)), Max: int64(max)}
+			}
+
+			packet, err = client.Reader.ReadSlice('\n')
+			line = append(line, packet...)
+		}
+		packet = line
+	}
+
+	if err != nil {
+		return nil, err
+	} else if max > 0 && len(packet) > max+2 {
+		return nil, &LimitError{Limit: "line length", Size: int64(len(packet) - 2), Max: int64(max)}
+	}
+
+	return packet, nil
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// limitedClient will create a client reading the given input under the limits
+func limitedClient(input io.Reader, limits ProtocolLimits) *BufferClient {
+	client := &BufferClient{Reader: bufio.NewReader(input)}
+	client.SetLimits(limits)
+	return client
+}
+
+// expectLimit will ensure the error is a limit error of the given limit
+func expectLimit(t *testing.T, err error, limit string) {
+	t.Helper()
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected a %s limit error, got %v", limit, err)
+	} else if limitErr.Limit != limit {
+		t.Fatalf("expected a %s limit error, got %v", limit, limitErr)
+	}
+}
+
+// allocated will return the number of bytes allocated while running f
+func allocated(f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestLimitsBulkLength(t *testing.T) {
+	client := limitedClient(strings.NewReader("$536870911\r\n"), DefaultProtocolLimits())
+	_, err := client.ReadInterface()
+	expectLimit(t, err, "bulk length")
+
+	client = limitedClient(strings.NewReader("*1\r\n$536870911\r\n"), DefaultProtocolLimits())
+	_, err = client.ReadBulkPayload()
+	expectLimit(t, err, "bulk length")
+}
+
+func TestLimitsBulkReadAsItArrives(t *testing.T) {
+	// a bulk within the limits that is declared but never sent is not allocated up front
+	limits := DefaultProtocolLimits()
+	limits.MaxBulkLength = 1 << 30
+
+	var err error
+	n := allocated(func() {
+		client := limitedClient(strings.NewReader("$1073741824\r\nshort"), limits)
+		_, err = client.ReadInterface()
+	})
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected an unexpected eof, got %v", err)
+	} else if n > 1<<20 {
+		t.Fatalf("expected the bulk not to be allocated from its declared length, allocated %d bytes", n)
+	}
+
+	client := limitedClient(strings.NewReader("$200000\r\n"+strings.Repeat("a", 200000)+"\r\n"), limits)
+	if v, err := client.ReadInterface(); err != nil || len(v.([]byte)) != 200000 {
+		t.Fatalf("expected the bulk to be read, got %v", err)
+	}
+}
+
+func TestLimitsArrayLength(t *testing.T) {
+	client := limitedClient(strings.NewReader("*2000000\r\n"), DefaultProtocolLimits())
+	_, err := client.ReadInterface()
+	expectLimit(t, err, "array length")
+
+	client = limitedClient(strings.NewReader("*2000000\r\n"), DefaultProtocolLimits())
+	_, err = client.ReadBulkPayload()
+	expectLimit(t, err, "array length")
+}
+
+func TestLimitsArrayReadAsItArrives(t *testing.T) {
+	// an array within the limits that is declared but never sent is not allocated up front
+	var err error
+	n := allocated(func() {
+		client := limitedClient(strings.NewReader("*1048576\r\n$1\r\na\r\n"), DefaultProtocolLimits())
+		_, err = client.ReadInterface()
+	})
+	if err != io.EOF {
+		t.Fatalf("expected an eof, got %v", err)
+	} else if n > 1<<20 {
+		t.Fatalf("expected the array not to be allocated from its declared length, allocated %d bytes", n)
+	}
+
+	n = allocated(func() {
+		client := limitedClient(strings.NewReader("*1048576\r\n$1\r\na\r\n"), DefaultProtocolLimits())
+		_, err = client.ReadBulkPayload()
+	})
+	if err != io.EOF {
+		t.Fatalf("expected an eof, got %v", err)
+	} else if n > 1<<20 {
+		t.Fatalf("expected the array not to be allocated from its declared length, allocated %d bytes", n)
+	}
+}
+
+func TestLimitsDepth(t *testing.T) {
+	limits := DefaultProtocolLimits()
+
+	client := limitedClient(strings.NewReader(strings.Repeat("*1\r\n", limits.MaxDepth+1)+"+OK\r\n"), limits)
+	_, err := client.ReadInterface()
+	expectLimit(t, err, "nesting depth")
+
+	client = limitedClient(strings.NewReader(strings.Repeat("*1\r\n", limits.MaxDepth)+"+OK\r\n"), limits)
+	if _, err := client.ReadInterface(); err != nil {
+		t.Fatalf("expected arrays nested within the limit to be read, got %v", err)
+	}
+}
+
+func TestLimitsLineLength(t *testing.T) {
+	// a line that never ends is rejected once it exceeds the limit rather than read in full
+	input := strings.Repeat("a", 4<<20)
+	var err error
+	n := allocated(func() {
+		client := limitedClient(strings.NewReader(input), DefaultProtocolLimits())
+		_, err = client.ReadLine()
+	})
+	expectLimit(t, err, "line length")
+	if n > 1<<20 {
+		t.Fatalf("expected the line to be rejected at the limit, allocated %d bytes", n)
+	}
+
+	client := limitedClient(strings.NewReader("PING "+strings.Repeat("a", 8192)+"\r\n"), DefaultProtocolLimits())
+	if line, err := client.ReadLine(); err != nil || len(line) != 8197 {
+		t.Fatalf("expected the line to be read, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+var levelNames = []string{"debug", "info", "warn", "error", "fatal"}
+
+func (level Level) String() string {
+	if level < LevelDebug || level > LevelFatal {
+		return "unknown"
+	}
+	return levelNames[level]
+}
+
+// ParseLevel will parse the name of a level (i.e. debug, info, warn, error, fatal)
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, errors.New("Invalid log level " + s + " specified, expected debug, info, warn, error or fatal")
+}
+
+// Field is a key/value pair attached to a log entry (i.e. client id, command)
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F will create a field with the given key and value
+func F(key string, value interface{}) Field {
+	return Field{key, value}
+}
+
+// Entry is a single log entry as it is written to the sinks
+type Entry struct {
+	Time    time.Time // time the entry was logged
+	Level   Level     // severity of the entry
+	Message string    // message describing what occurred
+	Err     error     // error associated with the entry (if any)
+	Fields  []Field   // key/value pairs associated with the entry
+}
+
+// Sink is a destination log entries are written to
+type Sink interface {
+	Write(entry *Entry) error
+	Close() error
+}
+
+// Logger is a structured logger that writes entries at or above its level to every sink. Entries
+// are written by a single routine so that logging never blocks the caller, entries logged while
+// the buffer is full are dropped and counted.
+type Logger struct {
+	sync.RWMutex
+
+	level    int32         // minimum level of the entries written
+	sinks    []Sink        // destinations of the entries
+	fallback Sink          // destination of the entries until a sink is added
+	entries  chan *Entry   // buffer of entries waiting to be written
+	dropped  int64         // number of entries dropped while the buffer was full
+	closed   bool          // true once the logger no longer accepts entries
+	done     chan struct{} // closed once every buffered entry has been written
+}
+
+// NewLogger will create a logger of the given level that buffers up to size entries, entries
+// are written as text to stderr until a sink is added
+func NewLogger(level Level, size int) *Logger {
+	logger := new(Logger)
+	logger.level = int32(level)
+	logger.sinks = make([]Sink, 0)
+	logger.fallback = NewTextSink(os.Stderr)
+	logger.entries = make(chan *Entry, size)
+	logger.done = make(chan struct{})
+	go logger.run()
+	return logger
+}
+
+// AddSink will add a destination the entries are written to, replacing stderr once the first
+// sink is added
+func (l *Logger) AddSink(sink Sink) {
+	l.Lock()
+	defer l.Unlock()
+	l.sinks = append(l.sinks, sink)
+}
+
+// SetLevel will change the minimum level of the entries written
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// Enabled will determine whether entries of the given level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= Level(atomic.LoadInt32(&l.level))
+}
+
+// Dropped will return the number of entries dropped while the buffer was full
+func (l *Logger) Dropped() int64 {
+	return atomic.LoadInt64(&l.dropped)
+}
+
+// Log will queue an entry of the given level to be written without blocking
+func (l *Logger) Log(level Level, msg string, err error, fields ...Field) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	entry := &Entry{time.Now(), level, msg, err, fields}
+	l.RLock()
+	defer l.RUnlock()
+	if l.closed {
+		return
+	}
+
+	select {
+	case l.entries <- entry:
+	default:
+		atomic.AddInt64(&l.dropped, 1)
+	}
+}
+
+// Debug will log a debug entry
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.Log(LevelDebug, msg, nil, fields...)
+}
+
+// Info will log an info entry
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.Log(LevelInfo, msg, nil, fields...)
+}
+
+// Warn will log a warning entry
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.Log(LevelWarn, msg, nil, fields...)
+}
+
+// Error will log an error entry
+func (l *Logger) Error(msg string, err error, fields ...Field) {
+	l.Log(LevelError, msg, err, fields...)
+}
+
+// Fatal will log a fatal entry (i.e. a recovered panic), it does not exit
+func (l *Logger) Fatal(msg string, err error, fields ...Field) {
+	l.Log(LevelFatal, msg, err, fields...)
+}
+
+// Close will stop accepting entries, write any that are buffered and close the sinks
+func (l *Logger) Close() error {
+	l.Lock()
+	if l.closed {
+		l.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.entries)
+	l.Unlock()
+
+	<-l.done
+	var err error
+	for _, sink := range l.sinks {
+		if e := sink.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// run will write the buffered entries to the sinks until the logger is closed
+func (l *Logger) run() {
+	defer close(l.done)
+	for entry := range l.entries {
+		l.RLock()
+		sinks := l.sinks
+		if len(sinks) == 0 {
+			sinks = []Sink{l.fallback}
+		}
+		l.RUnlock()
+
+		for _, sink := range sinks {
+			sink.Write(entry)
+		}
+	}
+}
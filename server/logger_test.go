@@ -0,0 +1,89 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testSink records the messages of the entries written to it, blocking while held
+type testSink struct {
+	sync.Mutex
+
+	messages []string
+	writing  chan struct{} // receives a value as each entry starts being written
+	hold     chan struct{} // entries are written once this receives a value or is closed
+}
+
+func newTestSink() *testSink {
+	return &testSink{writing: make(chan struct{}, 16), hold: make(chan struct{})}
+}
+
+func (s *testSink) Write(entry *Entry) error {
+	s.writing <- struct{}{}
+	<-s.hold
+	s.Lock()
+	defer s.Unlock()
+	s.messages = append(s.messages, entry.Message)
+	return nil
+}
+
+func (s *testSink) Close() error {
+	return nil
+}
+
+func TestLoggerDroppedEntries(t *testing.T) {
+	logger := NewLogger(LevelInfo, 1)
+	sink := newTestSink()
+	logger.AddSink(sink)
+
+	// the first entry is held by the sink, the second is buffered and the rest are dropped
+	logger.Info("first")
+	<-sink.writing
+	logger.Info("second")
+	logger.Info("third")
+	logger.Warn("fourth")
+	logger.Debug("below the level")
+	if n := logger.Dropped(); n != 2 {
+		t.Fatalf("expected 2 entries to be dropped, got %d", n)
+	}
+
+	close(sink.hold)
+	logger.Close()
+	if strings.Join(sink.messages, ",") != "first,second" {
+		t.Fatalf("expected the entries that were not dropped to be written, got %v", sink.messages)
+	}
+
+	// entries logged once closed are ignored rather than counted
+	logger.Info("closed")
+	if n := logger.Dropped(); n != 2 {
+		t.Fatalf("expected 2 entries to be dropped, got %d", n)
+	}
+}
+
+func TestLoggerFallback(t *testing.T) {
+	logger := NewLogger(LevelInfo, 8)
+	if sink, ok := logger.fallback.(*TextSink); !ok || sink.w != os.Stderr {
+		t.Fatalf("expected entries to be written to stderr until a sink is added, got %#v", logger.fallback)
+	}
+
+	// entries logged before a sink is configured are not discarded
+	fallback := newTestSink()
+	close(fallback.hold)
+	logger.fallback = fallback
+	logger.Info("before")
+	<-fallback.writing
+
+	sink := newTestSink()
+	close(sink.hold)
+	logger.AddSink(sink)
+	logger.Info("after")
+	logger.Close()
+
+	if strings.Join(fallback.messages, ",") != "before" {
+		t.Fatalf("expected only the entry logged without a sink to fall back, got %v", fallback.messages)
+	} else if strings.Join(sink.messages, ",") != "after" {
+		t.Fatalf("expected the entry logged once configured to be written to the sink, got %v", sink.messages)
+	}
+}
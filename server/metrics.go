@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// helpEscaper and labelEscaper escape the help text and label values of the exposition format
+var helpEscaper = strings.NewReplacer("\\", `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer("\\", `\\`, "\"", `\"`, "\n", `\n`)
+
+// MetricsCollector is implemented by backends that export their own metrics on the metrics endpoint
+type MetricsCollector interface {
+	CollectMetrics(w *MetricsWriter)
+}
+
+// MetricsWriter writes metrics in the prometheus text exposition format, a metric family is only
+// written once so that names which map to the same metric name never produce duplicate series
+type MetricsWriter struct {
+	buf     bytes.Buffer
+	written map[string]bool // metric families already written
+}
+
+// NewMetricsWriter will create a writer without any metrics written
+func NewMetricsWriter() *MetricsWriter {
+	return &MetricsWriter{written: make(map[string]bool)}
+}
+
+// MetricName will join the parts into a valid prometheus metric name, characters outside of
+// [a-zA-Z0-9_:] are replaced with underscores (i.e. "stats", "api.requests-2xx" becomes
+// stats_api_requests_2xx)
+func MetricName(parts ...string) string {
+	name := []byte(strings.Join(parts, "_"))
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || c >= '0' && c <= '9' && i > 0) {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// Gauge will write a metric family with a single sample whose value can go up and down
+func (w *MetricsWriter) Gauge(name, help string, value float64) {
+	if w.family(name, "gauge", help) {
+		w.sample(name, "", value)
+	}
+}
+
+// Counter will write a metric family with a single sample whose value only goes up
+func (w *MetricsWriter) Counter(name, help string, value float64) {
+	if w.family(name, "counter", help) {
+		w.sample(name, "", value)
+	}
+}
+
+// GaugeVec will write a metric family with a sample for each of the values labelled with its key
+// (i.e. broadcast_stats_value{key="api.requests"}), samples are written in the order of their keys
+func (w *MetricsWriter) GaugeVec(name, help, labelName string, values map[string]float64) {
+	if !w.family(name, "gauge", help) {
+		return
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		w.sample(name, label(labelName, key), values[key])
+	}
+}
+
+// family will write the help and type of the metric family, returning false if it was already written
+func (w *MetricsWriter) family(name, typ, help string) bool {
+	name = MetricName(name)
+	if w.written[name] {
+		return false
+	}
+
+	w.written[name] = true
+	w.buf.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+	w.buf.WriteString("# TYPE " + name + " " + typ + "\n")
+	return true
+}
+
+// sample will write a single sample of a metric family along with its labels (i.e. cmd="GET")
+func (w *MetricsWriter) sample(name, labels string, value float64) {
+	w.buf.WriteString(MetricName(name))
+	if len(labels) > 0 {
+		w.buf.WriteString("{" + labels + "}")
+	}
+	w.buf.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+// label will format a label pair with its value escaped
+func label(name, value string) string {
+	return name + "=\"" + labelEscaper.Replace(value) + "\""
+}
+
+// Bytes will return the metrics written so far
+func (w *MetricsWriter) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// WriteMetrics will write the metrics of the server internals (clients, connections, commands and
+// their latencies, memory) followed by the metrics of every backend implementing MetricsCollector
+func (app *BroadcastServer) WriteMetrics(w *MetricsWriter) error {
+	status, err := app.Status()
+	if err != nil {
+		return err
+	}
+
+	w.Gauge("broadcast_uptime_seconds", "Number of seconds since the server started", float64(status.Uptime))
+	w.Gauge("broadcast_goroutines", "Number of goroutines running", float64(status.NumGoroutines))
+	w.Gauge("broadcast_commands_in_flight", "Number of commands currently being dispatched", float64(status.NumInFlight))
+	w.Gauge("broadcast_connected_clients", "Number of connected clients", float64(status.NumClients))
+	w.Gauge("broadcast_monitor_clients", "Number of clients in MONITOR mode", float64(status.NumMonitors))
+	w.Gauge("broadcast_max_clients", "Maximum number of connected clients (0 for no limit)", float64(status.MaxClients))
+	w.Counter("broadcast_accepted_connections_total", "Number of accepted connections", float64(status.NumAccepted))
+	if w.family("broadcast_rejected_connections_total", "counter", "Number of rejected connections by reason") {
+		w.sample("broadcast_rejected_connections_total", label("reason", "max_clients"), float64(status.NumRejectedMaxClients))
+		w.sample("broadcast_rejected_connections_total", label("reason", "max_clients_ip"), float64(status.NumRejectedPerIP))
+		w.sample("broadcast_rejected_connections_total", label("reason", "accept_rate"), float64(status.NumRejectedRate))
+	}
+	w.Counter("broadcast_rate_limited_commands_total", "Number of commands rejected by rate limits", float64(status.NumRateLimited))
+	w.Counter("broadcast_rate_dropped_commands_total", "Number of fire and forget commands dropped by rate limits", float64(status.NumRateDropped))
+
+	cmds := make([]string, 0, len(status.Commands))
+	for cmd := range status.Commands {
+		cmds = append(cmds, cmd)
+	}
+	sort.Strings(cmds)
+
+	if w.family("broadcast_command_calls_total", "counter", "Number of times each command was dispatched") {
+		for _, cmd := range cmds {
+			w.sample("broadcast_command_calls_total", label("cmd", cmd), float64(status.Commands[cmd].Calls))
+		}
+	}
+	if w.family("broadcast_command_errors_total", "counter", "Number of calls of each command that failed with an error") {
+		for _, cmd := range cmds {
+			w.sample("broadcast_command_errors_total", label("cmd", cmd), float64(status.Commands[cmd].Errors))
+		}
+	}
+	if w.family("broadcast_command_duration_seconds", "histogram", "Latency of each command") {
+		for _, cmd := range cmds {
+			stat := status.Commands[cmd]
+			count := int64(0)
+			for i, n := range stat.Latency {
+				count += n
+				le := "+Inf"
+				if i < len(LatencyBuckets) {
+					le = strconv.FormatFloat(LatencyBuckets[i].Seconds(), 'g', -1, 64)
+				}
+				w.sample("broadcast_command_duration_seconds_bucket", label("cmd", cmd)+","+label("le", le), float64(count))
+			}
+			w.sample("broadcast_command_duration_seconds_sum", label("cmd", cmd), float64(stat.Usec)/1e6)
+			w.sample("broadcast_command_duration_seconds_count", label("cmd", cmd), float64(count))
+		}
+	}
+
+	w.Gauge("broadcast_memory_alloc_bytes", "Number of bytes of allocated heap objects", float64(status.Memory.Alloc))
+	w.Gauge("broadcast_memory_sys_bytes", "Number of bytes of memory obtained from the system", float64(status.Memory.Sys))
+	w.Gauge("broadcast_memory_heap_objects", "Number of allocated heap objects", float64(status.Memory.HeapObjects))
+	w.Counter("broadcast_memory_gc_total", "Number of completed garbage collection cycles", float64(status.Memory.NumGC))
+
+	for _, backend := range app.backends {
+		if collector, ok := backend.(MetricsCollector); ok {
+			collector.CollectMetrics(w)
+		}
+	}
+	return nil
+}
+
+// MetricsHandler will return an http handler serving the metrics of the server on /metrics
+func (app *BroadcastServer) MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", app.serveMetrics)
+	return mux
+}
+
+// serveMetrics will reply with the metrics of the server in the prometheus text format
+func (app *BroadcastServer) serveMetrics(rw http.ResponseWriter, r *http.Request) {
+	w := NewMetricsWriter()
+	if err := app.WriteMetrics(w); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.Write(w.Bytes())
+}
+
+// ListenMetrics will serve the metrics of the server over http on the given address
+// (i.e. 127.0.0.1:9331/metrics) until the server closes
+func (app *BroadcastServer) ListenMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	app.metrics = &http.Server{Handler: app.MetricsHandler()}
+	go func(metrics *http.Server) {
+		if err := metrics.Serve(listener); err != nil && err != http.ErrServerClosed {
+			app.Log.Error("metrics listener error", err, F("addr", addr))
+		}
+	}(app.metrics)
+
+	app.Log.Info("serving metrics", F("addr", listener.Addr().String()))
+	return nil
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// volatileMetrics are the samples whose values depend on the process or on timing, their values
+// are masked before the metrics are compared
+var volatileMetrics = regexp.MustCompile(`(?m)^(broadcast_(uptime_seconds|goroutines|commands_in_flight|memory_\w+|command_duration_seconds_(bucket|sum))(\{.*\})?) .*$`)
+
+// metricsBackend is a backend exporting metrics of its own
+type metricsBackend struct{}
+
+func (metricsBackend) Load() error   { return nil }
+func (metricsBackend) Unload() error { return nil }
+
+func (metricsBackend) CollectMetrics(w *MetricsWriter) {
+	w.Gauge("broadcast_test_gauge", "A gauge of the test backend", 1.5)
+	w.GaugeVec("broadcast_test_keys", "Keys of the test backend", "key", map[string]float64{"b": 2, "a.b-c": 1, "quote\"d": 3})
+	w.Gauge("broadcast_test_gauge", "A duplicate family is skipped", 9)
+}
+
+const expectedMetricsBeforeHistogram = `# HELP broadcast_uptime_seconds Number of seconds since the server started
+# TYPE broadcast_uptime_seconds gauge
+broadcast_uptime_seconds X
+# HELP broadcast_goroutines Number of goroutines running
+# TYPE broadcast_goroutines gauge
+broadcast_goroutines X
+# HELP broadcast_commands_in_flight Number of commands currently being dispatched
+# TYPE broadcast_commands_in_flight gauge
+broadcast_commands_in_flight X
+# HELP broadcast_connected_clients Number of connected clients
+# TYPE broadcast_connected_clients gauge
+broadcast_connected_clients 1
+# HELP broadcast_monitor_clients Number of clients in MONITOR mode
+# TYPE broadcast_monitor_clients gauge
+broadcast_monitor_clients 0
+# HELP broadcast_max_clients Maximum number of connected clients (0 for no limit)
+# TYPE broadcast_max_clients gauge
+broadcast_max_clients 0
+# HELP broadcast_accepted_connections_total Number of accepted connections
+# TYPE broadcast_accepted_connections_total counter
+broadcast_accepted_connections_total 1
+# HELP broadcast_rejected_connections_total Number of rejected connections by reason
+# TYPE broadcast_rejected_connections_total counter
+broadcast_rejected_connections_total{reason="max_clients"} 0
+broadcast_rejected_connections_total{reason="max_clients_ip"} 0
+broadcast_rejected_connections_total{reason="accept_rate"} 0
+# HELP broadcast_rate_limited_commands_total Number of commands rejected by rate limits
+# TYPE broadcast_rate_limited_commands_total counter
+broadcast_rate_limited_commands_total 0
+# HELP broadcast_rate_dropped_commands_total Number of fire and forget commands dropped by rate limits
+# TYPE broadcast_rate_dropped_commands_total counter
+broadcast_rate_dropped_commands_total 0
+# HELP broadcast_command_calls_total Number of times each command was dispatched
+# TYPE broadcast_command_calls_total counter
+broadcast_command_calls_total{cmd="GETK"} 1
+broadcast_command_calls_total{cmd="SETK"} 2
+# HELP broadcast_command_errors_total Number of calls of each command that failed with an error
+# TYPE broadcast_command_errors_total counter
+broadcast_command_errors_total{cmd="GETK"} 0
+broadcast_command_errors_total{cmd="SETK"} 1
+# HELP broadcast_command_duration_seconds Latency of each command
+# TYPE broadcast_command_duration_seconds histogram
+`
+
+const expectedMetricsAfterHistogram = `# HELP broadcast_memory_alloc_bytes Number of bytes of allocated heap objects
+# TYPE broadcast_memory_alloc_bytes gauge
+broadcast_memory_alloc_bytes X
+# HELP broadcast_memory_sys_bytes Number of bytes of memory obtained from the system
+# TYPE broadcast_memory_sys_bytes gauge
+broadcast_memory_sys_bytes X
+# HELP broadcast_memory_heap_objects Number of allocated heap objects
+# TYPE broadcast_memory_heap_objects gauge
+broadcast_memory_heap_objects X
+# HELP broadcast_memory_gc_total Number of completed garbage collection cycles
+# TYPE broadcast_memory_gc_total counter
+broadcast_memory_gc_total X
+# HELP broadcast_test_gauge A gauge of the test backend
+# TYPE broadcast_test_gauge gauge
+broadcast_test_gauge 1.5
+# HELP broadcast_test_keys Keys of the test backend
+# TYPE broadcast_test_keys gauge
+broadcast_test_keys{key="a.b-c"} 1
+broadcast_test_keys{key="b"} 2
+broadcast_test_keys{key="quote\"d"} 3
+`
+
+func TestMetricsEndpoint(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	if err := app.LoadBackend(metricsBackend{}); err != nil {
+		t.Fatal(err)
+	}
+	client := connect(t, app, l)
+
+	send(client, []string{"SETK", "a", "1"}, []string{"GETK", "a"}, []string{"SETK", "a"})
+	expect(t, client, "OK")
+	expect(t, client, "1")
+	reply(t, client)
+
+	rec := httptest.NewRecorder()
+	app.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Fatalf("expected the metrics in the text format, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	// every command has a bucket per latency bound (and +Inf) followed by the sum and count
+	histogram := ""
+	for _, cmd := range []string{"GETK", "SETK"} {
+		for _, le := range []string{"1e-05", "2.5e-05", "5e-05", "0.0001", "0.00025", "0.0005", "0.001", "0.0025",
+			"0.005", "0.01", "0.025", "0.05", "0.1", "0.25", "0.5", "1", "+Inf"} {
+			histogram += `broadcast_command_duration_seconds_bucket{cmd="` + cmd + `",le="` + le + `"} X` + "\n"
+		}
+		histogram += `broadcast_command_duration_seconds_sum{cmd="` + cmd + `"} X` + "\n"
+		histogram += `broadcast_command_duration_seconds_count{cmd="` + cmd + `"} ` + map[string]string{"GETK": "1", "SETK": "2"}[cmd] + "\n"
+	}
+
+	expected := expectedMetricsBeforeHistogram + histogram + expectedMetricsAfterHistogram
+	if metrics := volatileMetrics.ReplaceAllString(rec.Body.String(), "$1 X"); metrics != expected {
+		t.Fatalf("expected metrics:\n%s\ngot:\n%s", expected, metrics)
+	}
+}
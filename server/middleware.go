@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Dispatcher executes the named command with its argument data on behalf of the client
+type Dispatcher func(c context.Context, cmd string, data interface{}, client ProtocolClient) error
+
+// Middleware wraps the dispatch of every command. It sees the request context, command name,
+// arguments and client and may rewrite them before calling next, time the call, or short-circuit
+// by not calling next.
+type Middleware func(c context.Context, cmd string, data interface{}, client ProtocolClient, next Dispatcher) error
+
+// Use will append the middleware to the dispatch pipeline, middleware registered first runs first
+func (ctx *BroadcastContext) Use(middleware Middleware) {
+	ctx.middleware = append(ctx.middleware, middleware)
+	ctx.dispatch = ctx.handle
+	for i := len(ctx.middleware) - 1; i >= 0; i-- {
+		ctx.dispatch = chain(ctx.middleware[i], ctx.dispatch)
+	}
+}
+
+// Dispatch will run the command through the middleware pipeline and finally its registered handler,
+// all protocols dispatch their commands through here
+func (ctx *BroadcastContext) Dispatch(cmd string, data interface{}, client ProtocolClient) error {
+	if !ctx.beginRequest() {
+		return errShuttingDown
+	}
+
+	client.Touch(cmd)
+	c, cancel := ctx.requestContext(cmd, client)
+	if _, ok := c.Deadline(); ok && ctx.recordable(cmd) {
+		return ctx.dispatchDeadline(c, cancel, cmd, data, client)
+	}
+
+	defer ctx.endRequest()
+	defer cancel()
+	return ctx.dispatch(c, cmd, data, client)
+}
+
+// dispatchDeadline will dispatch a command that has a deadline on its own routine and wait for it
+// until the deadline passes. The replies of the command are recorded and only written to the client
+// when it finishes in time, otherwise the deadline error is returned straight away. Handlers that do
+// not watch their context are not interrupted: the command keeps running (and stays in-flight) until
+// its handler returns, but anything it replies is discarded.
+func (ctx *BroadcastContext) dispatchDeadline(c context.Context, cancel context.CancelFunc, cmd string, data interface{}, client ProtocolClient) error {
+	rc := newReplyClient(client)
+	done := make(chan error, 1)
+	go func() {
+		defer ctx.endRequest()
+		defer cancel()
+		defer func() {
+			if e := recover(); e != nil {
+				done <- ctx.recovered(e, client)
+			}
+		}()
+		done <- ctx.dispatch(c, cmd, data, rc)
+	}()
+
+	select {
+	case err := <-done:
+		rc.replay(client)
+		return err
+	case <-c.Done():
+		// the command may have finished just as the deadline passed
+		select {
+		case err := <-done:
+			rc.replay(client)
+			return err
+		default:
+			return c.Err()
+		}
+	}
+}
+
+// beginRequest will track a command as in-flight, no new commands are started once draining
+func (ctx *BroadcastContext) beginRequest() bool {
+	ctx.requestLock.Lock()
+	defer ctx.requestLock.Unlock()
+	if ctx.draining {
+		return false
+	}
+
+	ctx.inflight++
+	return true
+}
+
+// endRequest will mark an in-flight command as finished
+func (ctx *BroadcastContext) endRequest() {
+	ctx.requestLock.Lock()
+	defer ctx.requestLock.Unlock()
+	ctx.inflight--
+	ctx.checkDrained()
+}
+
+// BeginReply will track a reply as pending until EndReply is called once it has been flushed to
+// the client. Protocols that write replies after the commands have been dispatched (i.e. pipelined
+// batches) hold a reply for the whole batch so that a draining server waits for it to be flushed
+// rather than closing the connection with replies still buffered. Replies are tracked even while
+// draining, as the commands of the batch are then answered with an error.
+func (ctx *BroadcastContext) BeginReply() {
+	ctx.requestLock.Lock()
+	defer ctx.requestLock.Unlock()
+	ctx.replying++
+}
+
+// EndReply will mark a pending reply as flushed
+func (ctx *BroadcastContext) EndReply() {
+	ctx.requestLock.Lock()
+	defer ctx.requestLock.Unlock()
+	ctx.replying--
+	ctx.checkDrained()
+}
+
+// checkDrained will signal a drain once no commands or replies are pending, the caller holds the lock
+func (ctx *BroadcastContext) checkDrained() {
+	if ctx.inflight == 0 && ctx.replying == 0 && ctx.drained != nil {
+		close(ctx.drained)
+		ctx.drained = nil
+	}
+}
+
+// Drain will stop any new commands from being dispatched and return a channel that is closed
+// once every in-flight command has finished and its reply has been flushed
+func (ctx *BroadcastContext) Drain() <-chan struct{} {
+	ctx.requestLock.Lock()
+	defer ctx.requestLock.Unlock()
+	ctx.draining = true
+	drained := make(chan struct{})
+	if ctx.inflight == 0 && ctx.replying == 0 {
+		close(drained)
+	} else {
+		ctx.drained = drained
+	}
+	return drained
+}
+
+// InFlight will return the number of commands currently being dispatched
+func (ctx *BroadcastContext) InFlight() int {
+	ctx.requestLock.Lock()
+	defer ctx.requestLock.Unlock()
+	return ctx.inflight
+}
+
+// requestContext will create the context of a single command, it is cancelled once the client
+// closes, the server closes or the command's deadline passes (whichever happens first)
+func (ctx *BroadcastContext) requestContext(cmd string, client ProtocolClient) (context.Context, context.CancelFunc) {
+	c, cancel := context.WithCancel(client.Context())
+	stop := context.AfterFunc(ctx.base, cancel)
+	if timeout := ctx.CommandTimeout(cmd); timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		c, cancelTimeout = context.WithTimeout(c, timeout)
+		return c, func() {
+			stop()
+			cancelTimeout()
+			cancel()
+		}
+	}
+
+	return c, func() {
+		stop()
+		cancel()
+	}
+}
+
+// SetCommandTimeout will set the deadline for the given command, or for every command that does
+// not have its own deadline when cmd is empty. A timeout of 0 means no deadline, it is safe to
+// call while commands are being dispatched and applies to the commands dispatched afterwards.
+func (ctx *BroadcastContext) SetCommandTimeout(cmd string, timeout time.Duration) {
+	ctx.timeoutLock.Lock()
+	defer ctx.timeoutLock.Unlock()
+	if len(cmd) == 0 {
+		ctx.timeout = timeout
+	} else {
+		ctx.timeouts[strings.ToUpper(cmd)] = timeout
+	}
+}
+
+// CommandTimeout will return the deadline for the given command
+func (ctx *BroadcastContext) CommandTimeout(cmd string) time.Duration {
+	ctx.timeoutLock.RLock()
+	defer ctx.timeoutLock.RUnlock()
+	if timeout, ok := ctx.timeouts[cmd]; ok {
+		return timeout
+	}
+	return ctx.timeout
+}
+
+// handle will locate the registered handler for the command and call it
+func (ctx *BroadcastContext) handle(c context.Context, cmd string, data interface{}, client ProtocolClient) error {
+	handler, ok := ctx.Commands[cmd]
+	if !ok {
+		return ErrCmdNotFound
+	}
+
+	return handler(c, data, client)
+}
+
+// chain will bind the middleware to the next dispatcher in the pipeline
+func chain(middleware Middleware, next Dispatcher) Dispatcher {
+	return func(c context.Context, cmd string, data interface{}, client ProtocolClient) error {
+		return middleware(c, cmd, data, client, next)
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// monitorClient is a client in MONITOR mode along with the lines waiting to be written to it
+type monitorClient struct {
+	client ProtocolClient
+	lines  chan string
+}
+
+// Monitors tracks the clients in MONITOR mode. Every command executed is formatted once and handed
+// to each monitor without blocking, lines are dropped for any monitor that falls behind so that the
+// dispatch of commands is never slowed down by a monitor.
+type Monitors struct {
+	sync.RWMutex
+
+	count    int32                     // number of monitors, read without the lock on the dispatch path
+	monitors map[uint64]*monitorClient // monitors keyed by client id
+	dropped  int64                     // number of lines dropped because a monitor fell behind
+}
+
+// NewMonitors will create the monitor state of a server without any monitors
+func NewMonitors() *Monitors {
+	m := new(Monitors)
+	m.monitors = make(map[uint64]*monitorClient)
+	return m
+}
+
+// Add will put the client into MONITOR mode until it exits, returning false if it already is
+func (m *Monitors) Add(client ProtocolClient) bool {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.monitors[client.Id()]; ok {
+		return false
+	}
+
+	mc := &monitorClient{client, make(chan string, monitorBufferSize)}
+	m.monitors[client.Id()] = mc
+	atomic.AddInt32(&m.count, 1)
+	go m.stream(mc)
+	return true
+}
+
+// stream will write the lines of the monitor to its client until the client exits
+func (m *Monitors) stream(mc *monitorClient) {
+	for {
+		select {
+		case line := <-mc.lines:
+			mc.client.LockWrites()
+			mc.client.WriteString(line)
+			// write any other lines already waiting before flushing
+			for n := len(mc.lines); n > 0; n-- {
+				mc.client.WriteString(<-mc.lines)
+			}
+			mc.client.Flush()
+			mc.client.UnlockWrites()
+		case <-mc.client.WaitExit():
+			m.Lock()
+			delete(m.monitors, mc.client.Id())
+			atomic.AddInt32(&m.count, -1)
+			m.Unlock()
+			return
+		}
+	}
+}
+
+// Len will return the number of clients in MONITOR mode
+func (m *Monitors) Len() int {
+	return int(atomic.LoadInt32(&m.count))
+}
+
+// Dropped will return the number of lines dropped because a monitor fell behind
+func (m *Monitors) Dropped() int64 {
+	return atomic.LoadInt64(&m.dropped)
+}
+
+// Feed will hand the command to every monitor, it returns immediately when there are no monitors
+// and never waits on a monitor that has fallen behind
+func (m *Monitors) Feed(cmd string, data interface{}, client ProtocolClient) {
+	if atomic.LoadInt32(&m.count) == 0 {
+		return
+	}
+
+	line := monitorLine(time.Now(), cmd, data, client)
+	m.RLock()
+	defer m.RUnlock()
+	for _, mc := range m.monitors {
+		select {
+		case mc.lines <- line:
+		default:
+			atomic.AddInt64(&m.dropped, 1)
+		}
+	}
+}
+
+// monitorLine will format the command executed by the client as a single line with the time, client
+// id, protocol, address and quoted arguments (i.e. 1475078400.123456 [3 redis 127.0.0.1:60514] "INCR" "total"),
+// the password of AUTH is never included
+func monitorLine(t time.Time, cmd string, data interface{}, client ProtocolClient) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%06d [%d %s %s] %s", t.Unix(), t.Nanosecond()/1000, client.Id(), client.Protocol(), client.Address(), strconv.Quote(cmd))
+	if redactedCommands[cmd] {
+		b.WriteString(" " + strconv.Quote(redacted))
+		return b.String()
+	}
+
+	for _, arg := range argList(data) {
+		b.WriteByte(' ')
+		if v, ok := arg.([]byte); ok {
+			b.WriteString(strconv.Quote(string(v)))
+		} else {
+			b.WriteString(strconv.Quote(fmt.Sprint(arg)))
+		}
+	}
+	return b.String()
+}
+
+// monitor is the middleware that hands every command executed to the clients in MONITOR mode
+func (ctx *BroadcastContext) monitor(c context.Context, cmd string, data interface{}, client ProtocolClient, next Dispatcher) error {
+	ctx.Monitors.Feed(cmd, data, client)
+	return next(c, cmd, data, client)
+}
+
+// monitorCmd will stream every command executed by the server to the client until it quits, the
+// client is no longer subject to the idle timeout
+func (ctx *BroadcastContext) monitorCmd(c context.Context, data interface{}, client ProtocolClient) error {
+	client.SetIdleTimeout(0)
+	client.WriteString("OK")
+	if err := client.Flush(); err != nil {
+		return err
+	}
+
+	ctx.Monitors.Add(client)
+	return nil
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// expectMonitorLine will read the next monitor line and ensure it ends with the quoted command
+func expectMonitorLine(t *testing.T, client *NetworkClient, suffix string) {
+	t.Helper()
+	line, ok := reply(t, client).(string)
+	if !ok || !strings.HasSuffix(line, suffix) {
+		t.Fatalf("expected a monitor line ending with %q, got %q", suffix, line)
+	}
+}
+
+func TestMonitorOutlivesIdleTimeout(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	l.SetOptions(ListenerOptions{IdleTimeout: 100 * time.Millisecond})
+	registerStore(app)
+	monitor := connect(t, app, l)
+
+	send(monitor, []string{"MONITOR"})
+	expect(t, monitor, "OK")
+
+	// the monitor stays idle well past the timeout while the next request is being read
+	time.Sleep(300 * time.Millisecond)
+
+	client := connect(t, app, l)
+	send(client, []string{"SETK", "a", "1"})
+	expect(t, client, "OK")
+	expectMonitorLine(t, monitor, `"SETK" "a" "1"`)
+}
+
+func TestMonitorRedactsAuth(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	monitor := connect(t, app, l)
+
+	send(monitor, []string{"MONITOR"})
+	expect(t, monitor, "OK")
+
+	client := connect(t, app, l)
+	send(client, []string{"AUTH", "default", "secret"}, []string{"GETK", "a"})
+	reply(t, client)
+	reply(t, client)
+	expectMonitorLine(t, monitor, `"AUTH" "(redacted)"`)
+	expectMonitorLine(t, monitor, `"GETK" "a"`)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ListenerOptions are the settings applied to every connection accepted by a listener
+type ListenerOptions struct {
+	IdleTimeout time.Duration // close clients that have not sent anything for this long, subscribers are exempt (0 for none)
+	KeepAlive   time.Duration // tcp keepalive period (0 for the system default, negative to disable)
+	NoDelay     bool          // disable nagle's algorithm on tcp connections
+	Heartbeat   time.Duration // interval of heartbeats sent to clients subscribed to topics (0 for none)
+}
+
+// DefaultListenerOptions will return the options listeners are created with
+func DefaultListenerOptions() ListenerOptions {
+	return ListenerOptions{0, 0, true, 0}
+}
+
+// heartbeat is the message sent to subscribed clients on every heartbeat
+var heartbeat = []byte("HEARTBEAT")
+
+// Options will return the connection settings of the listener
+func (l *BroadcastListener) Options() ListenerOptions {
+	return l.options
+}
+
+// SetOptions will change the connection settings of the listener, options must be set before AcceptConnections
+func (l *BroadcastListener) SetOptions(options ListenerOptions) {
+	l.options = options
+}
+
+// configureConn will apply the tcp settings of the listener to the connection
+func (l *BroadcastListener) configureConn(conn net.Conn) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	tcpConn.SetNoDelay(l.options.NoDelay)
+	if l.options.KeepAlive < 0 {
+		tcpConn.SetKeepAlive(false)
+	} else if l.options.KeepAlive > 0 {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(l.options.KeepAlive)
+	}
+}
+
+// heartbeat will periodically send a heartbeat to the client while it is subscribed to any topics
+// until the client exits, clients that can no longer be written to are closed
+func (l *BroadcastListener) heartbeat(client ProtocolClient) {
+	ticker := time.NewTicker(l.options.Heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-client.WaitExit():
+			return
+		case now := <-ticker.C:
+			if client.Info().Subscriptions == 0 {
+				continue
+			}
+
+			client.LockWrites()
+			client.WriteBulk([][]byte{heartbeat, []byte(strconv.FormatInt(now.Unix(), 10))})
+			err := client.Flush()
+			client.UnlockWrites()
+			if err != nil {
+				client.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Request is a single command read from a client along with its arguments
+type Request struct {
+	Cmd  string      // name of the command (uppercase)
+	Args interface{} // arguments of the command ([][]byte or []interface{} depending on the protocol)
+}
+
+// RequestReader will read the next request from the client, it is called by a single routine
+type RequestReader func() (Request, error)
+
+// pipelined is a request read ahead of its execution, or the error that ended the reads
+type pipelined struct {
+	req Request
+	err error
+}
+
+// replyClient is a client whose replies are recorded rather than written so that commands can run
+// concurrently and still have their replies written to the connection in request order. Replies
+// are replayed through the write methods of the client they were recorded for, so protocols that
+// encode replies their own way write them exactly as they would have written them directly. Every
+// method other than the writes is forwarded to the client.
+type replyClient struct {
+	ProtocolClient
+
+	replies []func(client ProtocolClient) error
+}
+
+func newReplyClient(client ProtocolClient) *replyClient {
+	return &replyClient{ProtocolClient: client}
+}
+
+// record will keep the reply until it is replayed
+func (rc *replyClient) record(reply func(client ProtocolClient) error) error {
+	rc.replies = append(rc.replies, reply)
+	return nil
+}
+
+// replay will write the recorded replies to the client in the order they were recorded
+func (rc *replyClient) replay(client ProtocolClient) {
+	for _, reply := range rc.replies {
+		reply(client)
+	}
+}
+
+// copyBytes will copy the bytes written so that the caller is free to reuse them
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+// LockWrites does nothing, nothing is written to the client until the replies are replayed
+func (rc *replyClient) LockWrites() {}
+
+// UnlockWrites does nothing, nothing is written to the client until the replies are replayed
+func (rc *replyClient) UnlockWrites() {}
+
+// Flush does nothing, the replies are flushed once they have been replayed
+func (rc *replyClient) Flush() error {
+	return nil
+}
+
+func (rc *replyClient) Write(b []byte) (int, error) {
+	b = copyBytes(b)
+	return len(b), rc.record(func(client ProtocolClient) error {
+		_, err := client.Write(b)
+		return err
+	})
+}
+
+func (rc *replyClient) WriteLen(prefix byte, n int) error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteLen(prefix, n) })
+}
+
+func (rc *replyClient) WriteString(s string) error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteString(s) })
+}
+
+func (rc *replyClient) WriteByte(b byte) error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteByte(b) })
+}
+
+func (rc *replyClient) WriteBytes(b []byte) error {
+	b = copyBytes(b)
+	return rc.record(func(client ProtocolClient) error { return client.WriteBytes(b) })
+}
+
+func (rc *replyClient) WriteInt64(n int64) error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteInt64(n) })
+}
+
+func (rc *replyClient) WriteFloat64(n float64) error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteFloat64(n) })
+}
+
+func (rc *replyClient) WriteBool(b bool) error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteBool(b) })
+}
+
+func (rc *replyClient) WriteError(e error) error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteError(e) })
+}
+
+func (rc *replyClient) WriteNull() error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteNull() })
+}
+
+func (rc *replyClient) WriteBulk(data [][]byte) error {
+	bulk := make([][]byte, len(data))
+	for i, b := range data {
+		bulk[i] = copyBytes(b)
+	}
+	return rc.record(func(client ProtocolClient) error { return client.WriteBulk(bulk) })
+}
+
+func (rc *replyClient) WriteInterface(arg interface{}) error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteInterface(arg) })
+}
+
+func (rc *replyClient) WriteArray(args []interface{}) error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteArray(args) })
+}
+
+func (rc *replyClient) WriteJson(arg interface{}) error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteJson(arg) })
+}
+
+func (rc *replyClient) WriteCommand(cmd string, args []interface{}) error {
+	return rc.record(func(client ProtocolClient) error { return client.WriteCommand(cmd, args) })
+}
+
+// Write will write bytes already encoded by the protocol to the client
+func (client *BufferClient) Write(b []byte) (int, error) {
+	return client.Writer.Write(b)
+}
+
+// Serve will read ahead the requests of the client and dispatch them in batches until the client
+// quits or a read fails, returning ErrQuit or the read error once every request before it has been
+// replied to (nil when the client exits first). Within a batch, consecutive readonly commands run
+// concurrently (unless they are being queued by MULTI) while any other command runs on its own once
+// the commands before it have finished, replies are always written in request order and flushed to
+// the connection once per batch. A batch holds a pending reply until it has been flushed so that a
+// graceful shutdown never closes the connection before the batch has been replied to.
+func (ctx *BroadcastContext) Serve(client ProtocolClient, read RequestReader) error {
+	requests := make(chan pipelined, pipelineDepth)
+	go ctx.readAhead(client, read, requests)
+
+	for item := range requests {
+		batch := append(make([]pipelined, 0, 8), item)
+	more:
+		for item.err == nil && len(batch) < pipelineDepth {
+			select {
+			case next, ok := <-requests:
+				if !ok {
+					break more
+				}
+				item = next
+				batch = append(batch, item)
+			default:
+				break more
+			}
+		}
+
+		ctx.BeginReply()
+		err := ctx.runBatch(client, batch)
+		client.LockWrites()
+		client.Flush()
+		client.UnlockWrites()
+		ctx.EndReply()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAhead will read requests from the client until it quits, a read fails or the client exits
+func (ctx *BroadcastContext) readAhead(client ProtocolClient, read RequestReader, requests chan<- pipelined) {
+	defer close(requests)
+	for {
+		req, err := ctx.readRequest(client, read)
+		if err == nil && req.Cmd == "QUIT" {
+			err = ErrQuit
+		}
+
+		select {
+		case requests <- pipelined{req, err}:
+		case <-client.WaitExit():
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readRequest will read the next request, a panic while reading ends the reads with an error
+func (ctx *BroadcastContext) readRequest(client ProtocolClient, read RequestReader) (req Request, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = ctx.recovered(e, client)
+		}
+	}()
+	return read()
+}
+
+// runBatch will dispatch the requests of a batch and write their replies in order, returning the
+// error that ended the reads (if it was reached)
+func (ctx *BroadcastContext) runBatch(client ProtocolClient, batch []pipelined) error {
+	var wg sync.WaitGroup
+	replies := make([]*replyClient, 0, len(batch))
+	for _, item := range batch {
+		if item.err != nil {
+			wg.Wait()
+			ctx.writeReplies(client, replies)
+			return item.err
+		}
+
+		cmd := item.req.Cmd
+		help, declared := ctx.CommandHelp[cmd]
+		if declared && help.Flags.Has(FlagReadOnly) && !help.Flags.Has(FlagBlocking) && !ctx.Transactions.Queuing(client) {
+			rc := newReplyClient(client)
+			replies = append(replies, rc)
+			wg.Add(1)
+			go func(req Request) {
+				defer wg.Done()
+				ctx.dispatchReply(req, rc)
+			}(item.req)
+			continue
+		}
+
+		// any other command waits for the commands before it so that it observes their effects
+		wg.Wait()
+		ctx.writeReplies(client, replies)
+		replies = replies[:0]
+
+		if ctx.recordable(cmd) {
+			rc := newReplyClient(client)
+			ctx.dispatchReply(item.req, rc)
+			ctx.writeReplies(client, []*replyClient{rc})
+		} else {
+			// blocking commands and commands without declarations may hold on to the client and
+			// write to it after they return, and direct commands may close the connection once
+			// they have replied, so they write to the connection directly
+			client.LockWrites()
+			client.Flush()
+			ctx.dispatchReply(item.req, client)
+			client.UnlockWrites()
+		}
+	}
+
+	wg.Wait()
+	ctx.writeReplies(client, replies)
+	return nil
+}
+
+// recordable will determine whether the replies of the command can be recorded, blocking commands
+// and commands without declarations may hold on to the client and write to it after they return
+// while direct commands must have replied before they close the connection
+func (ctx *BroadcastContext) recordable(cmd string) bool {
+	help, ok := ctx.CommandHelp[cmd]
+	return ok && help.Declared() && !help.Flags.Has(FlagBlocking) && !help.Flags.Has(FlagDirect)
+}
+
+// dispatchReply will dispatch the request and write the error it fails with (if any) to the client
+func (ctx *BroadcastContext) dispatchReply(req Request, client ProtocolClient) {
+	defer func() {
+		if e := recover(); e != nil {
+			client.WriteError(ctx.recovered(e, client))
+		}
+	}()
+
+	if err := ctx.Dispatch(req.Cmd, req.Args, client); err != nil {
+		ctx.Log.Error("accept error", err, F("client", client.Id()), F("addr", client.Address()), F("cmd", req.Cmd))
+		client.WriteError(err)
+	}
+}
+
+// recovered will log a panic recovered while serving the client along with its stack
+func (ctx *BroadcastContext) recovered(e interface{}, client ProtocolClient) error {
+	buf := make([]byte, 4096)
+	n := runtime.Stack(buf, false)
+	ctx.Log.Fatal("client run panic", errors.New(fmt.Sprintf("%v", e)), F("client", client.Id()), F("stack", string(buf[0:n])))
+	return errInternal
+}
+
+// writeReplies will write the buffered replies to the client in order
+func (ctx *BroadcastContext) writeReplies(client ProtocolClient, replies []*replyClient) {
+	client.LockWrites()
+	defer client.UnlockWrites()
+	for _, rc := range replies {
+		rc.replay(client)
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// registerDelay will register a readonly DELAY command that replies with its argument after
+// sleeping for that many milliseconds
+func registerDelay(app *BroadcastServer) {
+	app.RegisterCommand(Command{Name: "DELAY", Usage: "DELAY ms", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly, Args: []ArgType{ArgInteger}},
+		func(data interface{}, client ProtocolClient) error {
+			ms, _ := strconv.Atoi(args(data)[0])
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			client.WriteString(args(data)[0])
+			return client.Flush()
+		})
+}
+
+func TestPipelineReplyOrder(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerDelay(app)
+	registerStore(app)
+	client := connect(t, app, l)
+
+	// readonly commands finishing out of order, a write between them and an unknown command
+	send(client,
+		[]string{"DELAY", "40"},
+		[]string{"DELAY", "20"},
+		[]string{"SETK", "a", "1"},
+		[]string{"DELAY", "0"},
+		[]string{"GETK", "a"},
+		[]string{"NOPE"},
+		[]string{"DELAY", "10"},
+		[]string{"GETK", "b"})
+
+	expect(t, client, "40")
+	expect(t, client, "20")
+	expect(t, client, "OK")
+	expect(t, client, "0")
+	expect(t, client, "1")
+	expectError(t, client, ErrCmdNotFound.Error())
+	expect(t, client, "10")
+	if v := reply(t, client); v != nil {
+		t.Fatalf("expected null reply, got %#v", v)
+	}
+}
+
+func TestPipelineReadOnlyConcurrency(t *testing.T) {
+	app, _ := newTestServer(t, nil)
+
+	// every BARRIER waits for the others to start, which only happens if they run concurrently
+	n := int32(4)
+	running := int32(0)
+	app.RegisterCommand(Command{Name: "BARRIER", Flags: FlagReadOnly}, func(data interface{}, client ProtocolClient) error {
+		atomic.AddInt32(&running, 1)
+		deadline := time.Now().Add(2 * time.Second)
+		for atomic.LoadInt32(&running) < n {
+			if time.Now().After(deadline) {
+				client.WriteString("TIMEOUT")
+				return client.Flush()
+			}
+			time.Sleep(time.Millisecond)
+		}
+		client.WriteString("OK")
+		return client.Flush()
+	})
+
+	server, conn := net.Pipe()
+	defer server.Close()
+	defer conn.Close()
+	sc, _ := NewNetworkClient(server)
+	cc, _ := NewNetworkClient(conn)
+
+	batch := make([]pipelined, n)
+	for i := range batch {
+		batch[i] = pipelined{req: Request{Cmd: "BARRIER", Args: []interface{}{}}}
+	}
+	go func() {
+		app.ctx.runBatch(sc, batch)
+		sc.Flush()
+	}()
+
+	for i := int32(0); i < n; i++ {
+		expect(t, cc, "OK")
+	}
+}
+
+func TestPipelineWriteWaitsForReadOnly(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	store := registerStore(app)
+
+	// the write must only run once the slow readonly command before it has finished
+	finished := int32(0)
+	app.RegisterCommand(Command{Name: "SLOWREAD", Flags: FlagReadOnly}, func(data interface{}, client ProtocolClient) error {
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+		client.WriteString("OK")
+		return client.Flush()
+	})
+	app.RegisterCommand(Command{Name: "CHECK", Flags: FlagWrite}, func(data interface{}, client ProtocolClient) error {
+		client.WriteInt64(int64(atomic.LoadInt32(&finished)))
+		return client.Flush()
+	})
+	client := connect(t, app, l)
+
+	send(client, []string{"SLOWREAD"}, []string{"CHECK"}, []string{"SETK", "a", "1"})
+	expect(t, client, "OK")
+	if v := reply(t, client); v != int64(1) {
+		t.Fatalf("expected the write to run after the readonly command, got %#v", v)
+	}
+	expect(t, client, "OK")
+
+	store.Lock()
+	defer store.Unlock()
+	if store.values["a"] != "1" {
+		t.Fatalf("expected a to be set, got %q", store.values["a"])
+	}
+}
+
+// shoutProtocol is the default protocol with clients that encode string replies their own way
+type shoutProtocol struct {
+	DefaultBroadcastServerProtocol
+}
+
+func (p *shoutProtocol) HandleConnection(conn net.Conn) (ProtocolClient, error) {
+	client := new(shoutClient)
+	client.Initialize(conn, 128)
+	return client, nil
+}
+
+type shoutClient struct {
+	NetworkClient
+}
+
+func (client *shoutClient) WriteString(s string) error {
+	return client.NetworkClient.WriteString(strings.ToUpper(s) + "!")
+}
+
+func TestPipelineRepliesUseProtocolEncoding(t *testing.T) {
+	app, l := newTestServer(t, new(shoutProtocol))
+	registerDelay(app)
+	registerStore(app)
+	client := connect(t, app, l)
+
+	send(client, []string{"DELAY", "5"}, []string{"SETK", "a", "x"}, []string{"GETK", "a"})
+	expect(t, client, "5!")
+	expect(t, client, "OK!")
+	expect(t, client, "X!")
+}
+
+func TestPipelineShutdownFlushesInFlightReplies(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	app.RegisterCommand(Command{Name: "SLOW", Flags: FlagWrite}, func(data interface{}, client ProtocolClient) error {
+		close(started)
+		<-release
+		client.WriteString("DONE")
+		return client.Flush()
+	})
+	client := connect(t, app, l)
+
+	send(client, []string{"SLOW"}, []string{"SETK", "a", "1"})
+	<-started
+
+	shutdown := make(chan struct{})
+	go func() {
+		app.Shutdown(5 * time.Second)
+		close(shutdown)
+	}()
+
+	// let the command finish only once the server is draining
+	for !draining(app.ctx) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	expect(t, client, "DONE")
+	select {
+	case <-shutdown:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the shutdown to complete once the reply was flushed")
+	}
+}
+
+func TestPipelineShutdownRejectsNewCommands(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	client := connect(t, app, l)
+
+	send(client, []string{"SETK", "a", "1"})
+	expect(t, client, "OK")
+
+	app.ctx.Drain()
+	send(client, []string{"GETK", "a"})
+	expectError(t, client, errShuttingDown.Error())
+}
+
+// draining will determine whether the context has started draining
+func draining(ctx *BroadcastContext) bool {
+	ctx.requestLock.Lock()
+	defer ctx.requestLock.Unlock()
+	return ctx.draining
+}
+
+func TestPipelineSubscriberOutlivesIdleTimeout(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	l.SetOptions(ListenerOptions{IdleTimeout: 100 * time.Millisecond})
+	registerStore(app)
+	app.RegisterCommand(Command{Name: "SUB", FireForget: true, MinArgs: 1, MaxArgs: Variadic, Flags: FlagPubSub | FlagBlocking},
+		func(data interface{}, client ProtocolClient) error {
+			client.AddSubscriptions(len(args(data)))
+			return nil
+		})
+	subscriber := connect(t, app, l)
+	idle := connect(t, app, l)
+
+	// the next request is already being read while SUB runs, the subscription clears its deadline
+	send(subscriber, []string{"SUB", "topic"})
+	time.Sleep(300 * time.Millisecond)
+
+	send(subscriber, []string{"GETK", "a"})
+	if v := reply(t, subscriber); v != nil {
+		t.Fatalf("expected the subscriber to be served, got %#v", v)
+	}
+
+	idle.Conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := idle.ReadInterface(); err == nil {
+		t.Fatal("expected the idle client to be closed")
+	}
+}
@@ -10,12 +10,19 @@ import (
 )
 
 type BroadcastServerProtocol interface {
-	HandleConnection(conn *net.TCPConn) (ProtocolClient, error)
+	HandleConnection(conn net.Conn) (ProtocolClient, error)
 	RunClient(client ProtocolClient)
 	Initialize(ctx *BroadcastContext) error
 	Name() string
 }
 
+// ConnectionRejecter is implemented by protocols that reply to the connections rejected by admission
+// control in their own format (i.e. an http response), other protocols are written an error reply.
+// The rejecter is responsible for closing the connection.
+type ConnectionRejecter interface {
+	RejectConnection(conn net.Conn, err error)
+}
+
 type DefaultBroadcastServerProtocol struct {
 	ctx *BroadcastContext
 }
@@ -36,7 +43,7 @@ func (p *DefaultBroadcastServerProtocol) Initialize(ctx *BroadcastContext) error
 // HandleConnection will create several routines for handling a new network connection to the broadcast server.
 // This method will create a simple client, spawn both write and read routines where appropriate, handle
 // disconnects, and finalize the client connection when the server is disposing
-func (p *DefaultBroadcastServerProtocol) HandleConnection(conn *net.TCPConn) (ProtocolClient, error) {
+func (p *DefaultBroadcastServerProtocol) HandleConnection(conn net.Conn) (ProtocolClient, error) {
 	return NewNetworkClient(conn)
 }
 
@@ -50,38 +57,46 @@ func (p *DefaultBroadcastServerProtocol) RunClient(client ProtocolClient) {
 			buf := make([]byte, 4096)
 			n := runtime.Stack(buf, false)
 			buf = buf[0:n]
-			p.ctx.Events <- BroadcastEvent{"fatal", "client run panic", errors.New(fmt.Sprintf("%v", e)), buf}
+			p.ctx.Log.Fatal("client run panic", errors.New(fmt.Sprintf("%v", e)), F("client", client.Id()), F("stack", string(buf)))
 		}
 
 		client.Close()
 		return
 	}()
 
-	for {
-		data, err := client.ReadInterface()
-		if err != nil {
-			if err != io.EOF {
-				p.ctx.Events <- BroadcastEvent{"error", "read error", err, nil}
+	err := p.ctx.Serve(client, func() (Request, error) {
+		for {
+			data, err := client.ReadInterface()
+			if err != nil {
+				return Request{}, err
 			}
-			return
-		}
 
-		err = p.handleData(data, client)
-		if err != nil {
-			if err == errQuit {
-				client.WriteString("OK")
-				client.Flush()
-				return
-			} else {
-				p.ctx.Events <- BroadcastEvent{"error", "accept error", err, nil}
-				client.WriteError(err)
-				client.Flush()
+			if req, ok := p.request(data); ok {
+				return req, nil
 			}
 		}
+	})
+
+	if err == ErrQuit {
+		client.LockWrites()
+		client.WriteString("OK")
+		client.Flush()
+		client.UnlockWrites()
+	} else if err != nil {
+		if _, ok := err.(*LimitError); ok {
+			client.LockWrites()
+			client.WriteError(err)
+			client.Flush()
+			client.UnlockWrites()
+		}
+		if err != io.EOF && !client.IsClosed() {
+			p.ctx.Log.Error("read error", err, F("client", client.Id()), F("addr", client.Address()))
+		}
 	}
 }
 
-func (p *DefaultBroadcastServerProtocol) handleData(data interface{}, client ProtocolClient) error {
+// request will read the command and arguments from the data, data that is not an array is ignored
+func (p *DefaultBroadcastServerProtocol) request(data interface{}) (Request, bool) {
 	switch data := data.(type) {
 	case []interface{}:
 		{
@@ -92,21 +107,12 @@ func (p *DefaultBroadcastServerProtocol) handleData(data interface{}, client Pro
 				} else {
 					cmd = strings.ToUpper(data[0].(string))
 				}
+				return Request{cmd, data[1:]}, true
 			}
 
-			switch cmd {
-			case "QUIT":
-				return errQuit
-			default:
-				handler, ok := p.ctx.Commands[cmd]
-				if !ok {
-					return errCmdNotFound
-				}
-
-				return handler(data[1:], client)
-			}
+			return Request{cmd, data}, true
 		}
 	}
 
-	return nil
+	return Request{}, false
 }
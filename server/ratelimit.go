@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket limit on how often a command (or category of commands) may run
+type RateLimit struct {
+	Rate        float64 // commands permitted per second
+	Burst       int     // commands permitted at once above the rate
+	PerIdentity bool    // share the limit across every connection of an authenticated identity
+}
+
+// bucket is the token bucket of a single limit and scope (connection or identity)
+type bucket struct {
+	tokens float64   // available tokens
+	last   time.Time // last time the tokens were replenished
+}
+
+// refill will replenish the bucket based on the time elapsed since it was last refilled
+func (b *bucket) refill(limit RateLimit, now time.Time) {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+}
+
+// RateLimiter enforces the rate limits of commands and categories for every client
+type RateLimiter struct {
+	sync.Mutex
+
+	limits   map[string]RateLimit // limits keyed by command name or @category
+	buckets  map[string]*bucket   // token buckets keyed by scope and limit
+	watching map[uint64]struct{}  // clients with per connection buckets that are removed once they exit
+	limited  int64                // commands rejected with an error
+	dropped  int64                // fire and forget commands silently dropped
+	hits     map[string]int64     // limit hits by command
+}
+
+// NewRateLimiter will create a rate limiter without any limits
+func NewRateLimiter() *RateLimiter {
+	limiter := new(RateLimiter)
+	limiter.limits = make(map[string]RateLimit)
+	limiter.buckets = make(map[string]*bucket)
+	limiter.watching = make(map[uint64]struct{})
+	limiter.hits = make(map[string]int64)
+	return limiter
+}
+
+// SetLimit will limit the given command, or category of commands when prefixed with @ (i.e. @write)
+func (r *RateLimiter) SetLimit(target string, limit RateLimit) {
+	r.Lock()
+	defer r.Unlock()
+	if strings.HasPrefix(target, "@") {
+		r.limits[strings.ToLower(target)] = limit
+	} else {
+		r.limits[strings.ToUpper(target)] = limit
+	}
+}
+
+// Enabled will determine whether any limits have been set
+func (r *RateLimiter) Enabled() bool {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.limits) > 0
+}
+
+// Allow will determine whether the client may run the command under every limit that applies to it,
+// a token is only taken from each of the buckets once all of them permit the command
+func (r *RateLimiter) Allow(cmd string, categories []string, client ProtocolClient) bool {
+	return r.allow(cmd, categories, client, time.Now())
+}
+
+// allow will determine whether the client may run the command at the given time
+func (r *RateLimiter) allow(cmd string, categories []string, client ProtocolClient, now time.Time) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	targets := append([]string{cmd}, categories...)
+	buckets := make([]*bucket, 0, len(targets))
+	for i, target := range targets {
+		if i > 0 {
+			target = "@" + target
+		}
+
+		limit, ok := r.limits[target]
+		if !ok {
+			continue
+		}
+
+		key := r.scope(limit, client) + "/" + target
+		b, ok := r.buckets[key]
+		if !ok {
+			b = new(bucket)
+			r.buckets[key] = b
+		}
+
+		b.refill(limit, now)
+		if b.tokens < 1 {
+			r.hits[cmd]++
+			return false
+		}
+		buckets = append(buckets, b)
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true
+}
+
+// scope will return the key the client's buckets are shared by for the given limit
+func (r *RateLimiter) scope(limit RateLimit, client ProtocolClient) string {
+	if limit.PerIdentity {
+		if user := client.User(); user != nil {
+			return "user:" + user.Name
+		} else if identity := client.Identity(); len(identity) > 0 {
+			return "cn:" + identity
+		}
+	}
+
+	id := client.Id()
+	if _, ok := r.watching[id]; !ok {
+		r.watching[id] = struct{}{}
+		go r.watch(client)
+	}
+	return "id:" + strconv.FormatUint(id, 10)
+}
+
+// watch will wait for the client to exit and remove its per connection buckets
+func (r *RateLimiter) watch(client ProtocolClient) {
+	<-client.WaitExit()
+
+	r.Lock()
+	defer r.Unlock()
+	id := client.Id()
+	prefix := "id:" + strconv.FormatUint(id, 10) + "/"
+	delete(r.watching, id)
+	for key := range r.buckets {
+		if strings.HasPrefix(key, prefix) {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// Stats will return the number of limited and dropped commands along with the limit hits by command
+func (r *RateLimiter) Stats() (int64, int64, map[string]int64) {
+	r.Lock()
+	defer r.Unlock()
+	hits := make(map[string]int64, len(r.hits))
+	for k, v := range r.hits {
+		hits[k] = v
+	}
+	return r.limited, r.dropped, hits
+}
+
+// ratelimit is the middleware that rejects commands exceeding their rate limits, fire and forget
+// commands are dropped silently as the client will not read a reply
+func (ctx *BroadcastContext) ratelimit(c context.Context, cmd string, data interface{}, client ProtocolClient, next Dispatcher) error {
+	if !ctx.RateLimiter.Enabled() || ctx.RateLimiter.Allow(cmd, ctx.ACL.Categories(cmd), client) {
+		return next(c, cmd, data, client)
+	}
+
+	ctx.RateLimiter.Lock()
+	defer ctx.RateLimiter.Unlock()
+	if help, ok := ctx.CommandHelp[cmd]; ok && help.FireForget {
+		ctx.RateLimiter.dropped++
+		return nil
+	}
+
+	ctx.RateLimiter.limited++
+	return fmt.Errorf("RATELIMIT rate limit exceeded for the '%s' command", cmd)
+}
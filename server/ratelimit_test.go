@@ -0,0 +1,153 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// limitedTestClient will create a client with the given id for rate limiting, the client exits
+// once the test completes
+func limitedTestClient(t *testing.T, id uint64) *NetworkClient {
+	server, conn := net.Pipe()
+	client, _ := NewNetworkClient(server)
+	client.SetId(id)
+	t.Cleanup(func() {
+		client.Close()
+		conn.Close()
+	})
+	return client
+}
+
+func TestRateLimitBurstAndRefill(t *testing.T) {
+	r := NewRateLimiter()
+	r.SetLimit("get", RateLimit{Rate: 10, Burst: 2})
+	client := limitedTestClient(t, 1)
+
+	now := time.Now()
+	if !r.allow("GET", nil, client, now) || !r.allow("GET", nil, client, now) {
+		t.Fatal("expected the burst to be allowed")
+	} else if r.allow("GET", nil, client, now) {
+		t.Fatal("expected the command to be limited once the burst is used")
+	}
+
+	// a tenth of a second replenishes a single token at 10 per second
+	now = now.Add(100 * time.Millisecond)
+	if !r.allow("GET", nil, client, now) {
+		t.Fatal("expected a replenished token to be allowed")
+	} else if r.allow("GET", nil, client, now) {
+		t.Fatal("expected a single token to be replenished")
+	}
+
+	// tokens never replenish beyond the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if !r.allow("GET", nil, client, now) {
+			t.Fatal("expected the burst to be allowed")
+		}
+	}
+	if r.allow("GET", nil, client, now) {
+		t.Fatal("expected the burst to be enforced")
+	}
+
+	// commands without limits are always allowed
+	if !r.allow("SET", []string{"write"}, client, now) {
+		t.Fatal("expected commands without limits to be allowed")
+	}
+
+	if _, _, hits := r.Stats(); hits["GET"] != 3 {
+		t.Fatalf("expected 3 limit hits, got %d", hits["GET"])
+	}
+}
+
+func TestRateLimitCategories(t *testing.T) {
+	r := NewRateLimiter()
+	r.SetLimit("set", RateLimit{Rate: 1, Burst: 5})
+	r.SetLimit("@write", RateLimit{Rate: 1, Burst: 1})
+	client := limitedTestClient(t, 1)
+
+	now := time.Now()
+	if !r.allow("SET", []string{"write"}, client, now) {
+		t.Fatal("expected the command to be allowed")
+	} else if r.allow("SET", []string{"write"}, client, now) {
+		t.Fatal("expected the category limit to apply to the command")
+	} else if r.allow("DEL", []string{"write"}, client, now) {
+		t.Fatal("expected the category limit to be shared by its commands")
+	}
+
+	// rejections by the category do not take tokens from the command
+	r.Lock()
+	tokens := r.buckets["id:1/SET"].tokens
+	r.Unlock()
+	if tokens != 4 {
+		t.Fatalf("expected the command bucket to have 4 tokens, got %v", tokens)
+	}
+
+	now = now.Add(time.Second)
+	if !r.allow("SET", []string{"write"}, client, now) {
+		t.Fatal("expected the command to be allowed once the category replenishes")
+	}
+}
+
+func TestRateLimitScope(t *testing.T) {
+	r := NewRateLimiter()
+	r.SetLimit("get", RateLimit{Rate: 1, Burst: 1})
+	r.SetLimit("set", RateLimit{Rate: 1, Burst: 1, PerIdentity: true})
+
+	user := &User{Name: "app"}
+	first, second, anonymous := limitedTestClient(t, 1), limitedTestClient(t, 2), limitedTestClient(t, 3)
+	first.SetUser(user)
+	second.SetUser(user)
+
+	now := time.Now()
+	if !r.allow("GET", nil, first, now) || !r.allow("GET", nil, second, now) {
+		t.Fatal("expected limits to apply per connection")
+	} else if !r.allow("SET", nil, first, now) {
+		t.Fatal("expected the command to be allowed")
+	} else if r.allow("SET", nil, second, now) {
+		t.Fatal("expected identity limits to be shared by the connections of a user")
+	} else if !r.allow("SET", nil, anonymous, now) {
+		t.Fatal("expected identity limits to apply per connection without a user")
+	}
+
+	// per connection buckets are removed once the client exits
+	anonymous.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.Lock()
+		_, ok := r.buckets["id:3/SET"]
+		r.Unlock()
+		if !ok {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("expected the buckets of the client to be removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	app.RegisterCommand(Command{Name: "NOTIFY", FireForget: true}, func(data interface{}, client ProtocolClient) error {
+		return nil
+	})
+	app.ctx.RateLimiter.SetLimit("getk", RateLimit{Rate: 0.001, Burst: 1})
+	app.ctx.RateLimiter.SetLimit("notify", RateLimit{Rate: 0.001, Burst: 1})
+	client := connect(t, app, l)
+
+	// pipelined readonly commands run concurrently, the first is sent alone so that it takes the token
+	send(client, []string{"GETK", "a"})
+	if v := reply(t, client); v != nil {
+		t.Fatalf("expected a null reply, got %#v", v)
+	}
+
+	send(client, []string{"GETK", "a"}, []string{"NOTIFY"}, []string{"NOTIFY"}, []string{"SETK", "a", "1"})
+	expectError(t, client, "RATELIMIT rate limit exceeded for the 'GETK' command")
+	expect(t, client, "OK")
+
+	limited, dropped, _ := app.ctx.RateLimiter.Stats()
+	if limited != 1 || dropped != 1 {
+		t.Fatalf("expected 1 limited and 1 dropped command, got %d limited and %d dropped", limited, dropped)
+	}
+}
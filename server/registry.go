@@ -0,0 +1,87 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ClientRegistry is a concurrent safe set of connected clients, each client is assigned a unique
+// monotonically increasing id as it is added which is never reused for the lifetime of the server
+type ClientRegistry struct {
+	sync.RWMutex
+
+	clients map[uint64]ProtocolClient // clients keyed by their unique id
+	nextId  uint64                    // last id assigned to a client
+}
+
+// NewClientRegistry will create an empty client registry
+func NewClientRegistry() *ClientRegistry {
+	registry := new(ClientRegistry)
+	registry.clients = make(map[uint64]ProtocolClient)
+	return registry
+}
+
+// Add will assign the client the next unique id and register it, returning the assigned id
+func (r *ClientRegistry) Add(client ProtocolClient) uint64 {
+	id := atomic.AddUint64(&r.nextId, 1)
+	client.SetId(id)
+
+	r.Lock()
+	r.clients[id] = client
+	r.Unlock()
+	return id
+}
+
+// Remove will unregister the client with the given id, returning false if it was not registered
+func (r *ClientRegistry) Remove(id uint64) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.clients[id]; !ok {
+		return false
+	}
+
+	delete(r.clients, id)
+	return true
+}
+
+// Get will return the client registered with the given id
+func (r *ClientRegistry) Get(id uint64) (ProtocolClient, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	client, ok := r.clients[id]
+	return client, ok
+}
+
+// Len will return the number of registered clients
+func (r *ClientRegistry) Len() int {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.clients)
+}
+
+// List will return a snapshot of the registered clients ordered by their id
+func (r *ClientRegistry) List() []ProtocolClient {
+	r.RLock()
+	clients := make([]ProtocolClient, 0, len(r.clients))
+	for _, client := range r.clients {
+		clients = append(clients, client)
+	}
+	r.RUnlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Id() < clients[j].Id()
+	})
+	return clients
+}
+
+// Each will call fn for a snapshot of the registered clients in id order until fn returns false,
+// the registry is not locked while fn is called so it is free to add or remove clients
+func (r *ClientRegistry) Each(fn func(client ProtocolClient) bool) {
+	for _, client := range r.List() {
+		if !fn(client) {
+			return
+		}
+	}
+}
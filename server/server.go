@@ -1,41 +1,78 @@
 package server
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"runtime"
 	"strconv"
+	"sync"
+	"time"
 )
 
 // BroadcastServer represents a construct for the application as a whole including
-// the various address, protocol, network listener, connected clients, and overall
-// server state that can be used for either reporting, or communicating with services.
+// the various listeners, protocols, connected clients, and overall server state
+// that can be used for either reporting, or communicating with services.
 type BroadcastServer struct {
-	port     int                       // port to listen on
-	host     string                    // host to bind to
-	addr     string                    // address to bind to
-	bit      string                    // 32-bit vs 64-bit version
-	pid      int                       // pid of the broadcast server
-	listener *net.TCPListener          // listener for the broadcast server
-	clients  map[string]ProtocolClient // clients is a map of all the connected clients to the server
-	ctx      *BroadcastContext
-	backends []Backend               // registered backends with the broadcast server
+	sync.Mutex
+
+	bit       string               // 32-bit vs 64-bit version
+	pid       int                  // pid of the broadcast server
+	started   time.Time            // time the broadcast server was created
+	listeners []*BroadcastListener // listeners bound to the broadcast server
+	ctx       *BroadcastContext
+	backends  []Backend     // registered backends with the broadcast server
+	metrics   *http.Server  // http server of the metrics endpoint (if any)
+	Closed    bool          // closed is the boolean for when the application has already been closed
+	Quit      chan struct{} // quit is a simple channel signal for when the application quits
+	Log       *Logger       // structured logger of the server, shared with the context
+	Name      string        // canonical name of the broadcast server
+	Version   string        // version of the broadcast server
+	Header    string        // header for the broadcast server
+}
+
+// BroadcastListener represents a single network listener owned by the broadcast server,
+// each listener accepts connections on its own address and handles them with its own protocol
+type BroadcastListener struct {
+	port     int                     // port listened on (for tcp listeners)
+	network  string                  // network of the listener (i.e. tcp, unix)
+	addr     string                  // address bound to
+	listener net.Listener            // network listener for incoming connections
 	protocol BroadcastServerProtocol // server protocol for handling connections
-	Closed   bool                    // closed is the boolean for when the application has already been closed
-	Quit     chan struct{}           // quit is a simple channel signal for when the application quits
-	Events   chan BroadcastEvent     // events is a channel for when emitted data occurs in the application
-	Name     string                  // canonical name of the broadcast server
-	Version  string                  // version of the broadcast server
-	Header   string                  // header for the broadcast server
+	options  ListenerOptions         // settings applied to accepted connections
 }
 
 type BroadcastServerStatus struct {
+	Name          string            // canonical name of the broadcast server
+	Version       string            // version of the broadcast server
+	Pid           int               // pid of the broadcast server
+	Uptime        int64             // number of seconds since the broadcast server started
+	Listeners     []string          // addresses of the listeners bound to the broadcast server
 	NumGoroutines int               // number of go-routines running
 	NumCpu        int               // number of cpu's running
 	NumCgoCall    int64             // number of cgo calls
+	NumInFlight   int               // number of commands currently being dispatched
 	Memory        *runtime.MemStats // memory statistics running
 	NumClients    int               // number of connected clients
+	NumMonitors   int               // number of clients in MONITOR mode
+	MaxClients    int               // maximum number of connected clients (0 for no limit)
+
+	NumAccepted           int64 // number of accepted connections
+	NumRejected           int64 // number of rejected connections
+	NumRejectedMaxClients int64 // number of connections rejected by the max clients limit
+	NumRejectedPerIP      int64 // number of connections rejected by the per address limit
+	NumRejectedRate       int64 // number of connections rejected by the accept rate limit
+
+	NumRateLimited int64            // number of commands rejected by rate limits
+	NumRateDropped int64            // number of fire and forget commands dropped by rate limits
+	RateLimitHits  map[string]int64 // number of rate limit hits by command
+
+	Commands map[string]CommandStat // calls, errors and latency by command
+	Backends []BackendStatus        // loaded backends along with any statistics they report
 }
 
 type Backend interface {
@@ -50,38 +87,180 @@ func Listen(port int, host string) (*BroadcastServer, error) {
 
 // ListenProtocol uses the address parameters and the specified protocol to construct the broadcast server
 func ListenProtocol(port int, host string, protocol BroadcastServerProtocol) (*BroadcastServer, error) {
-	app := new(BroadcastServer)
-	app.port = port
-	app.host = host
-	app.addr = host + ":" + strconv.Itoa(port)
-	app.bit = BroadcastBit
-	app.pid = os.Getpid()
+	app := NewBroadcastServer()
+	_, err := app.AddListener(port, host, protocol)
+	if err != nil {
+		return nil, err
+	}
 
-	// listen on the given protocol/port/host
-	serverAddr, err := net.ResolveTCPAddr("tcp", app.addr)
+	return app, nil
+}
+
+// ListenNet will construct the broadcast server on top of the given network listener and protocol
+func ListenNet(listener net.Listener, protocol BroadcastServerProtocol) (*BroadcastServer, error) {
+	app := NewBroadcastServer()
+	_, err := app.AddNetListener(listener, protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	return app, nil
+}
+
+// ListenUnix uses the unix socket path, file mode and the specified protocol to construct the broadcast server
+func ListenUnix(path string, mode os.FileMode, protocol BroadcastServerProtocol) (*BroadcastServer, error) {
+	app := NewBroadcastServer()
+	_, err := app.AddUnixListener(path, mode, protocol)
 	if err != nil {
 		return nil, err
 	}
 
-	listener, err := net.ListenTCP("tcp", serverAddr)
+	return app, nil
+}
+
+// ListenTLS uses the address parameters, tls configuration and the specified protocol to construct the broadcast server
+func ListenTLS(port int, host string, config *tls.Config, protocol BroadcastServerProtocol) (*BroadcastServer, error) {
+	app := NewBroadcastServer()
+	_, err := app.AddTLSListener(port, host, config, protocol)
 	if err != nil {
 		return nil, err
 	}
 
-	app.listener = listener
+	return app, nil
+}
+
+// NewBroadcastServer will construct a broadcast server without any listeners, listeners can
+// then be added via AddListener so that several protocols share the same context and backends
+func NewBroadcastServer() *BroadcastServer {
+	app := new(BroadcastServer)
+	app.bit = BroadcastBit
+	app.pid = os.Getpid()
+	app.started = time.Now()
 	app.ctx = NewBroadcastContext()
-	app.clients = make(map[string]ProtocolClient)
+	app.listeners = make([]*BroadcastListener, 0)
 	app.backends = make([]Backend, 0)
-	app.protocol = protocol
 
 	app.Closed = false
 	app.Quit = make(chan struct{})
-	app.Events = app.ctx.Events
+	app.Log = app.ctx.Log
 	app.Name = "Broadcast"
 
 	app.Version = BroadcastVersion
 	app.Header = LogoHeader
-	return app, nil
+	return app
+}
+
+// AddListener will bind a new tcp listener on the given address parameters that will handle
+// its connections with the specified protocol. Listeners must be added before AcceptConnections.
+func (app *BroadcastServer) AddListener(port int, host string, protocol BroadcastServerProtocol) (*BroadcastListener, error) {
+	// listen on the given protocol/port/host
+	listener, err := net.Listen("tcp", host+":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, err
+	}
+
+	return app.AddNetListener(listener, protocol)
+}
+
+// AddTLSListener will bind a new tls listener on the given address parameters, see NewTLSConfig for
+// loading certificates and requiring verified client certificates (mutual tls)
+func (app *BroadcastServer) AddTLSListener(port int, host string, config *tls.Config, protocol BroadcastServerProtocol) (*BroadcastListener, error) {
+	listener, err := tls.Listen("tcp", host+":"+strconv.Itoa(port), config)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.AddNetListener(listener, protocol)
+}
+
+// AddUnixListener will bind a new unix domain socket listener at the given path with the given file
+// mode (or the default umask when 0). Stale sockets left behind by a previous server are removed.
+func (app *BroadcastServer) AddUnixListener(path string, mode os.FileMode, protocol BroadcastServerProtocol) (*BroadcastListener, error) {
+	listener, err := listenUnix(path, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.AddNetListener(listener, protocol)
+}
+
+// AddUnixTLSListener will bind a new unix domain socket listener like AddUnixListener that serves
+// tls, see NewTLSConfig for loading certificates and requiring verified client certificates
+func (app *BroadcastServer) AddUnixTLSListener(path string, mode os.FileMode, config *tls.Config, protocol BroadcastServerProtocol) (*BroadcastListener, error) {
+	listener, err := listenUnix(path, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.AddNetListener(tls.NewListener(listener, config), protocol)
+}
+
+// listenUnix will listen on the unix domain socket at the given path with the given file mode
+// (or the default umask when 0), removing any stale socket first
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	err := removeStaleSocket(path)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		err = os.Chmod(path, mode)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// removeStaleSocket will remove a socket file that no server is accepting connections on anymore,
+// sockets that are still in use and files that are not sockets are left untouched
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.New(path + " already exists and is not a socket")
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return errors.New(path + " is already in use")
+	}
+
+	return os.Remove(path)
+}
+
+// AddNetListener will use the given network listener (tcp, unix, tls or otherwise) to accept
+// connections that will be handled with the specified protocol.
+func (app *BroadcastServer) AddNetListener(listener net.Listener, protocol BroadcastServerProtocol) (*BroadcastListener, error) {
+	l := new(BroadcastListener)
+	l.listener = listener
+	l.network = listener.Addr().Network()
+	l.addr = listener.Addr().String()
+	l.protocol = protocol
+	l.options = DefaultListenerOptions()
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		l.port = addr.Port
+	}
+
+	app.listeners = append(app.listeners, l)
+	return l, nil
+}
+
+// Listeners will return the list of listeners currently bound to the broadcast server
+func (app *BroadcastServer) Listeners() []*BroadcastListener {
+	return app.listeners
 }
 
 // Load will load the backend service
@@ -92,7 +271,22 @@ func (app *BroadcastServer) LoadBackend(backend Backend) error {
 
 // Status will return the current state of the system and process
 func (app *BroadcastServer) Status() (*BroadcastServerStatus, error) {
-	return app.ctx.Status()
+	status, err := app.ctx.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	status.Name = app.Name
+	status.Version = app.Version
+	status.Pid = app.pid
+	status.Uptime = int64(time.Since(app.started) / time.Second)
+	for _, l := range app.listeners {
+		status.Listeners = append(status.Listeners, l.Address())
+	}
+	for _, backend := range app.backends {
+		status.Backends = append(status.Backends, backendStatus(backend))
+	}
+	return status, nil
 }
 
 // Help will output the current context help commands
@@ -105,6 +299,23 @@ func (app *BroadcastServer) RegisterCommand(cmd Command, handler Handler) {
 	app.ctx.RegisterCommand(cmd, handler)
 }
 
+// RegisterContextCommand takes a simple command structure and context aware handler to assign both the help info and the handler itself
+func (app *BroadcastServer) RegisterContextCommand(cmd Command, handler ContextHandler) {
+	app.ctx.RegisterContextCommand(cmd, handler)
+}
+
+// RegisterFunc will register an ordinary function as the handler of the command (i.e.
+// func(key string, delta int64) (int64, error)), arguments are decoded into the parameter types
+// and the return values are written to the client
+func (app *BroadcastServer) RegisterFunc(cmd Command, fn interface{}) error {
+	return app.ctx.RegisterFunc(cmd, fn)
+}
+
+// SetCommandTimeout will set the deadline for the given command, or for every command when cmd is empty
+func (app *BroadcastServer) SetCommandTimeout(cmd string, timeout time.Duration) {
+	app.ctx.SetCommandTimeout(cmd, timeout)
+}
+
 // Register will bind a particular byte/mark to a specific command handler (thus registering command handlers)
 func (app *BroadcastServer) Register(cmd string, handler Handler) {
 	app.ctx.Register(cmd, handler)
@@ -115,14 +326,101 @@ func (app *BroadcastServer) RegisterHelp(cmd Command) {
 	app.ctx.RegisterHelp(cmd)
 }
 
-// Address will return a string representation of the full server address (i.e. host:port)
+// Use will append the middleware to the pipeline every command is dispatched through
+func (app *BroadcastServer) Use(middleware Middleware) {
+	app.ctx.Use(middleware)
+}
+
+// RegisterCategory will add the given commands to an access control category (i.e. read, write, admin)
+func (app *BroadcastServer) RegisterCategory(category string, cmds ...string) {
+	app.ctx.RegisterCategory(category, cmds...)
+}
+
+// AddUser will add a user that clients can authenticate as, once any user is added clients must
+// authenticate (unless a default user without a password is defined)
+func (app *BroadcastServer) AddUser(user *User) {
+	app.ctx.ACL.AddUser(user)
+}
+
+// Authenticate will verify the credentials and authenticate the client as the given user
+func (app *BroadcastServer) Authenticate(client ProtocolClient, name string, password string) error {
+	user, err := app.ctx.ACL.Authenticate(name, password)
+	if err != nil {
+		return err
+	}
+
+	client.SetUser(user)
+	return nil
+}
+
+// SetMaxClients will limit the number of connected clients, connections beyond the limit are
+// rejected with an error (0 for no limit)
+func (app *BroadcastServer) SetMaxClients(n int) {
+	app.ctx.Admission.Lock()
+	defer app.ctx.Admission.Unlock()
+	app.ctx.Admission.MaxClients = n
+}
+
+// SetMaxClientsPerIP will limit the number of connected clients from a single source address (0 for no limit)
+func (app *BroadcastServer) SetMaxClientsPerIP(n int) {
+	app.ctx.Admission.Lock()
+	defer app.ctx.Admission.Unlock()
+	app.ctx.Admission.MaxClientsPerIP = n
+}
+
+// SetAcceptRate will limit the number of connections accepted per second, allowing bursts of up
+// to the given size (0 for no limit)
+func (app *BroadcastServer) SetAcceptRate(rate float64, burst int) {
+	app.ctx.Admission.Lock()
+	defer app.ctx.Admission.Unlock()
+	app.ctx.Admission.AcceptRate = rate
+	app.ctx.Admission.AcceptBurst = burst
+}
+
+// SetRateLimit will limit how often a command, or category of commands when prefixed with @
+// (i.e. @write), may be run by each connection or authenticated identity
+func (app *BroadcastServer) SetRateLimit(target string, limit RateLimit) {
+	app.ctx.RateLimiter.SetLimit(target, limit)
+}
+
+// SetProtocolLimits will limit the size of the requests read from clients, requests exceeding
+// the limits are rejected with a protocol error and the connection is closed
+func (app *BroadcastServer) SetProtocolLimits(limits ProtocolLimits) {
+	app.ctx.Limits = limits
+}
+
+// SetSlowLog will record the commands that run for at least the threshold (negative to disable)
+// in a slow log of up to maxLen entries
+func (app *BroadcastServer) SetSlowLog(threshold time.Duration, maxLen int) {
+	app.ctx.SlowLog.Configure(threshold, maxLen)
+}
+
+// SlowLog will return the commands that took longer than the slow log threshold to run
+func (app *BroadcastServer) SlowLog() *SlowLog {
+	return app.ctx.SlowLog
+}
+
+// Monitors will return the clients streaming every command executed by the server (MONITOR)
+func (app *BroadcastServer) Monitors() *Monitors {
+	return app.ctx.Monitors
+}
+
+// Address will return a string representation of the first listener address (i.e. host:port)
 func (app *BroadcastServer) Address() string {
-	return app.addr
+	if len(app.listeners) == 0 {
+		return ""
+	}
+	return app.listeners[0].addr
 }
 
-func (app *BroadcastServer) GetClient(id string) (ProtocolClient, bool) {
-	client, ok := app.clients[id]
-	return client, ok
+// GetClient will return the connected client with the given unique id
+func (app *BroadcastServer) GetClient(id uint64) (ProtocolClient, bool) {
+	return app.ctx.Clients.Get(id)
+}
+
+// Clients will return the registry of connected clients
+func (app *BroadcastServer) Clients() *ClientRegistry {
+	return app.ctx.Clients
 }
 
 // Close will end any open network connections, issue last minute commands and flush any transient data
@@ -131,57 +429,189 @@ func (app *BroadcastServer) Close() {
 		return
 	}
 
-	app.Events <- BroadcastEvent{"close", "broadcast server is closing.", nil, nil}
+	app.Log.Info("broadcast server is closing.")
 	app.Closed = true
-	for _, client := range app.clients {
-		client.Close()
-		app.ctx.ClientSize--
+	app.ctx.cancel()
+	app.closeClients()
+	app.unloadBackends()
+	app.closeListeners()
+	close(app.Quit)
+}
+
+// Shutdown will gracefully close the server. Listeners stop accepting connections and commands that
+// are already in-flight are given the drain period to finish (new commands are rejected), after which
+// connections are closed and backends are unloaded in reverse load order. Progress is reported
+// through the server log.
+func (app *BroadcastServer) Shutdown(drain time.Duration) {
+	if app.Closed {
+		return
 	}
-	for _, backend := range app.backends {
-		backend.Unload()
+
+	app.Log.Info("broadcast server is shutting down.")
+	app.Closed = true
+	app.closeListeners()
+	app.Log.Info("stopped accepting connections")
+
+	drained := app.ctx.Drain()
+	if n := app.ctx.InFlight(); n > 0 {
+		app.Log.Info("waiting for in-flight commands", F("drain", drain), F("inflight", n))
 	}
-	app.listener.Close()
+
+	select {
+	case <-drained:
+		app.Log.Info("in-flight commands completed")
+	case <-time.After(drain):
+		app.Log.Warn("drain period expired", F("inflight", app.ctx.InFlight()))
+	}
+
+	app.ctx.cancel()
+	app.Log.Info("closing connections", F("clients", app.ctx.Clients.Len()))
+	app.closeClients()
+	app.unloadBackends()
+	app.Log.Info("broadcast server shutdown complete.")
 	close(app.Quit)
 }
 
-// AcceptConnections will use the network listener for incoming clients in order to handle those connections
-// in an async manner. This will setup routines for both reading and writing to a connected client
+// closeClients will close every connected client, clients unregister themselves as they exit
+func (app *BroadcastServer) closeClients() {
+	app.ctx.Clients.Each(func(client ProtocolClient) bool {
+		client.Close()
+		return true
+	})
+}
+
+// closeListeners will stop every listener from accepting connections
+func (app *BroadcastServer) closeListeners() {
+	for _, l := range app.listeners {
+		l.listener.Close()
+	}
+	if app.metrics != nil {
+		app.metrics.Close()
+	}
+}
+
+// unloadBackends will unload the backends in the reverse order they were loaded, logging the
+// progress of each backend
+func (app *BroadcastServer) unloadBackends() {
+	for i := len(app.backends) - 1; i >= 0; i-- {
+		backend := fmt.Sprintf("%T", app.backends[i])
+		if err := app.backends[i].Unload(); err != nil {
+			app.Log.Error("unload backend error", err, F("backend", backend))
+		} else {
+			app.Log.Info("unloaded backend", F("backend", backend))
+		}
+	}
+}
+
+// AcceptConnections will use the network listeners for incoming clients in order to handle those connections
+// in an async manner. Each listener is served on its own routine while this call blocks until the server quits.
 func (app *BroadcastServer) AcceptConnections() {
-	app.Events <- BroadcastEvent{"info", fmt.Sprintf(app.Header, app.Name, app.Version, app.bit, app.port, app.pid), nil, nil}
-	app.Events <- BroadcastEvent{"info", "setting read/write protocol to " + app.protocol.Name(), nil, nil}
-	app.Events <- BroadcastEvent{"info", "listening for incoming connections on " + app.Address(), nil, nil}
+	port := 0
+	for _, l := range app.listeners {
+		if l.port > 0 {
+			port = l.port
+			break
+		}
+	}
+	app.Log.Info(fmt.Sprintf(app.Header, app.Name, app.Version, app.bit, port, app.pid))
 
-	err := app.protocol.Initialize(app.ctx)
-	if err != nil {
-		app.Events <- BroadcastEvent{"error", "accept error", err, nil}
-		return
+	for _, l := range app.listeners {
+		err := l.protocol.Initialize(app.ctx)
+		if err != nil {
+			app.Log.Error("accept error", err)
+			return
+		}
 	}
 
-	// accept connections, handle them via the protocol and run them
+	for _, l := range app.listeners {
+		app.Log.Info("listening for incoming "+l.protocol.Name()+" connections", F("addr", l.Address()))
+		go app.acceptListener(l)
+	}
+
+	<-app.Quit
+}
+
+// acceptListener will accept connections off of a single listener, handle them via the listener's protocol and run them
+func (app *BroadcastServer) acceptListener(l *BroadcastListener) {
 	for !app.Closed {
-		connection, err := app.listener.AcceptTCP()
+		connection, err := l.listener.Accept()
 		if err != nil {
-			app.Events <- BroadcastEvent{"error", "accept error", err, nil}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			} else if !app.Closed {
+				app.Log.Error("accept error", err, F("listener", l.Address()))
+			}
+			continue
+		}
+
+		if err := app.ctx.Admission.Admit(connection); err != nil {
+			go rejectConnection(l, connection, err)
 			continue
 		}
 
-		// Ensure that the connection is handled appropriately
-		client, err := app.protocol.HandleConnection(connection)
+		go app.handleConnection(l, connection)
+	}
+}
+
+// handleConnection will handle a newly accepted connection via the listener's protocol, register the
+// resulting client and run it. This occurs off of the accept routine as protocols may block on the
+// connection in order to determine how it should be handled (i.e. protocol detection).
+func (app *BroadcastServer) handleConnection(l *BroadcastListener, connection net.Conn) {
+	defer app.ctx.Admission.Release(connection)
+	l.configureConn(connection)
+
+	// complete the tls handshake up front so that client certificates are available to the protocol
+	if tlsConn, ok := connection.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		err := tlsConn.Handshake()
+		tlsConn.SetDeadline(time.Time{})
 		if err != nil {
 			connection.Close()
-			app.Events <- BroadcastEvent{"error", "accept error", err, nil}
-			continue
+			app.Log.Error("tls handshake error", err, F("addr", connection.RemoteAddr().String()))
+			return
 		}
+	}
 
-		app.clients[client.Address()] = client
-		app.ctx.ClientSize++
+	// Ensure that the connection is handled appropriately
+	client, err := l.protocol.HandleConnection(connection)
+	if err != nil {
+		connection.Close()
+		if err != io.EOF {
+			app.Log.Error("accept error", err, F("addr", connection.RemoteAddr().String()))
+		}
+		return
+	}
+
+	if client.Protocol() == "" {
+		client.SetProtocol(l.protocol.Name())
+	}
 
-		go func() {
-			<-client.WaitExit()
-			delete(app.clients, client.Address())
-			app.ctx.ClientSize--
-		}()
+	client.SetIdleTimeout(l.options.IdleTimeout)
+	client.SetLimits(app.ctx.Limits)
+	id := app.ctx.Clients.Add(client)
+	go func() {
+		<-client.WaitExit()
+		app.ctx.Clients.Remove(id)
+	}()
 
-		go app.protocol.RunClient(client)
+	if l.options.Heartbeat > 0 {
+		go l.heartbeat(client)
 	}
+
+	l.protocol.RunClient(client)
+}
+
+// Address will return a string representation of the listener address (i.e. host:port or socket path)
+func (l *BroadcastListener) Address() string {
+	return l.addr
+}
+
+// Network will return the network name of the listener (i.e. tcp, unix)
+func (l *BroadcastListener) Network() string {
+	return l.network
+}
+
+// Protocol will return the server protocol used to handle connections on this listener
+func (l *BroadcastListener) Protocol() BroadcastServerProtocol {
+	return l.protocol
 }
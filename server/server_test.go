@@ -0,0 +1,445 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeListener is the listener of test servers, connections are served over pipes by the tests
+// rather than accepted from the listener
+type pipeListener struct{}
+
+func (pipeListener) Accept() (net.Conn, error) { return nil, net.ErrClosed }
+func (pipeListener) Close() error              { return nil }
+func (pipeListener) Addr() net.Addr            { return pipeAddr{} }
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// newTestServer will create a server that serves the given protocol (the default protocol when nil)
+// over pipes, the server is closed once the test completes
+func newTestServer(t *testing.T, protocol BroadcastServerProtocol) (*BroadcastServer, *BroadcastListener) {
+	if protocol == nil {
+		protocol = NewDefaultBroadcastServerProtocol()
+	}
+
+	app := NewBroadcastServer()
+	l, err := app.AddNetListener(pipeListener{}, protocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protocol.Initialize(app.ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(app.Close)
+	return app, l
+}
+
+// connect will serve a new pipe connection on the listener and return a client of the other end
+func connect(t *testing.T, app *BroadcastServer, l *BroadcastListener) *NetworkClient {
+	server, conn := net.Pipe()
+	if err := app.ctx.Admission.Admit(server); err != nil {
+		t.Fatal(err)
+	}
+	go app.handleConnection(l, server)
+
+	client, _ := NewNetworkClient(conn)
+	t.Cleanup(client.Close)
+	return client
+}
+
+// send will write the commands to the connection at once (pipelined), each command is written as
+// an array of bulk strings
+func send(client *NetworkClient, cmds ...[]string) {
+	var buf bytes.Buffer
+	for _, cmd := range cmds {
+		buf.WriteString("*" + strconv.Itoa(len(cmd)) + "\r\n")
+		for _, arg := range cmd {
+			buf.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+		}
+	}
+
+	// pipes are synchronous, the server reads the commands while the test reads the replies
+	go client.Conn.Write(buf.Bytes())
+}
+
+// reply will read the next reply off of the connection
+func reply(t *testing.T, client *NetworkClient) interface{} {
+	t.Helper()
+	client.Conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	v, err := client.ReadInterface()
+	if err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	return v
+}
+
+// expect will read the next reply and compare it against the expected string reply
+func expect(t *testing.T, client *NetworkClient, expected string) {
+	t.Helper()
+	if v := reply(t, client); v != expected {
+		t.Fatalf("expected reply %q, got %#v", expected, v)
+	}
+}
+
+// expectError will read the next reply and compare it against the expected error reply
+func expectError(t *testing.T, client *NetworkClient, expected string) {
+	t.Helper()
+	v := reply(t, client)
+	if err, ok := v.(error); !ok || err.Error() != "ERR "+expected {
+		t.Fatalf("expected error %q, got %#v", expected, v)
+	}
+}
+
+// args will return the arguments of a command as strings
+func args(data interface{}) []string {
+	values := argList(data)
+	results := make([]string, len(values))
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			results[i] = string(b)
+		} else {
+			results[i] = v.(string)
+		}
+	}
+	return results
+}
+
+// testStore is a key value store for the commands registered by the tests
+type testStore struct {
+	sync.Mutex
+
+	values map[string]string
+}
+
+// registerStore will register GETK (readonly) and SETK (write) commands on a new store
+func registerStore(app *BroadcastServer) *testStore {
+	store := &testStore{values: make(map[string]string)}
+	app.RegisterCommand(Command{Name: "GETK", Usage: "GETK key", MinArgs: 1, MaxArgs: 1, Flags: FlagReadOnly, FirstKey: 1},
+		func(data interface{}, client ProtocolClient) error {
+			store.Lock()
+			v, ok := store.values[args(data)[0]]
+			store.Unlock()
+			if !ok {
+				client.WriteNull()
+			} else {
+				client.WriteString(v)
+			}
+			return client.Flush()
+		})
+	app.RegisterCommand(Command{Name: "SETK", Usage: "SETK key value", MinArgs: 2, MaxArgs: 2, Flags: FlagWrite, FirstKey: 1},
+		func(data interface{}, client ProtocolClient) error {
+			a := args(data)
+			store.Lock()
+			store.values[a[0]] = a[1]
+			store.Unlock()
+			client.WriteString("OK")
+			return client.Flush()
+		})
+	return store
+}
+
+// registerAuth will register an AUTH command authenticating the client as the given user
+func registerAuth(app *BroadcastServer) {
+	app.RegisterCommand(Command{Name: "AUTH", Usage: "AUTH username password", MinArgs: 2, MaxArgs: 2},
+		func(data interface{}, client ProtocolClient) error {
+			a := args(data)
+			if err := app.Authenticate(client, a[0], a[1]); err != nil {
+				return err
+			}
+			client.WriteString("OK")
+			return client.Flush()
+		})
+}
+
+// testCertificates are the certificates of a test certificate authority
+type testCertificates struct {
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	pool   *x509.CertPool
+	serial int64
+}
+
+func newTestCertificates(t *testing.T) *testCertificates {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return &testCertificates{ca, key, pool, 1}
+}
+
+// issue will create a certificate signed by the authority for the given common name
+func (certs *testCertificates) issue(t *testing.T, name string, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(certs.serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, certs.ca, &key.PublicKey, certs.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// connectTLS will serve a new tls connection over a pipe on the listener, verifying the client
+// certificate issued for the given name (no certificate is presented when the name is empty)
+func connectTLS(t *testing.T, app *BroadcastServer, l *BroadcastListener, certs *testCertificates, name string) *NetworkClient {
+	server, conn := net.Pipe()
+	serverConn := tls.Server(server, &tls.Config{
+		Certificates:           []tls.Certificate{certs.issue(t, "broadcast", x509.ExtKeyUsageServerAuth)},
+		ClientCAs:              certs.pool,
+		ClientAuth:             tls.VerifyClientCertIfGiven,
+		SessionTicketsDisabled: true,
+	})
+	if err := app.ctx.Admission.Admit(serverConn); err != nil {
+		t.Fatal(err)
+	}
+	go app.handleConnection(l, serverConn)
+
+	config := &tls.Config{RootCAs: certs.pool, ServerName: "broadcast"}
+	if len(name) > 0 {
+		config.Certificates = []tls.Certificate{certs.issue(t, name, x509.ExtKeyUsageClientAuth)}
+	}
+	clientConn := tls.Client(conn, config)
+	if err := clientConn.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, _ := NewNetworkClient(clientConn)
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestACLAuth(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	registerAuth(app)
+	app.AddUser(&User{Name: "app", Password: "secret", Commands: []string{"+@all"}})
+	app.AddUser(&User{Name: "hashed", Password: "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", Commands: []string{"+@all"}})
+	client := connect(t, app, l)
+
+	send(client, []string{"GETK", "a"}, []string{"AUTH", "app", "wrong"}, []string{"AUTH", "nobody", "secret"}, []string{"GETK", "a"})
+	expectError(t, client, errNoAuth.Error())
+	expectError(t, client, errInvalidAuth.Error())
+	expectError(t, client, errInvalidAuth.Error())
+	expectError(t, client, errNoAuth.Error())
+
+	send(client, []string{"AUTH", "app", "secret"}, []string{"SETK", "a", "1"})
+	expect(t, client, "OK")
+	expect(t, client, "OK")
+
+	other := connect(t, app, l)
+	send(other, []string{"AUTH", "hashed", "secret"}, []string{"GETK", "a"})
+	expect(t, other, "OK")
+	expect(t, other, "1")
+}
+
+func TestACLDefaultUser(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	registerAuth(app)
+	app.AddUser(&User{Name: DefaultUser, Commands: []string{"+@read"}})
+	app.AddUser(&User{Name: "admin", Password: "secret", Commands: []string{"+@all"}})
+	client := connect(t, app, l)
+
+	// clients act as the default user without a password until they authenticate
+	send(client, []string{"GETK", "a"}, []string{"SETK", "a", "1"}, []string{"AUTH", "admin", "secret"}, []string{"SETK", "a", "1"})
+	if v := reply(t, client); v != nil {
+		t.Fatalf("expected a null reply, got %#v", v)
+	}
+	expectError(t, client, "NOPERM user default has no permissions to run the 'SETK' command")
+	expect(t, client, "OK")
+	expect(t, client, "OK")
+}
+
+func TestACLCategoryDenied(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	registerAuth(app)
+	app.AddUser(&User{Name: "reader", Password: "secret", Commands: []string{"+@read", "-GET*", "+GETK"}})
+	app.AddUser(&User{Name: "writer", Password: "secret", Commands: []string{"+@all", "-@write"}})
+
+	reader := connect(t, app, l)
+	send(reader, []string{"AUTH", "reader", "secret"}, []string{"GETK", "a"}, []string{"SETK", "a", "1"})
+	expect(t, reader, "OK")
+	if v := reply(t, reader); v != nil {
+		t.Fatalf("expected a null reply, got %#v", v)
+	}
+	expectError(t, reader, "NOPERM user reader has no permissions to run the 'SETK' command")
+
+	// the last matching rule wins
+	writer := connect(t, app, l)
+	send(writer, []string{"AUTH", "writer", "secret"}, []string{"SETK", "a", "1"}, []string{"GETK", "a"})
+	expect(t, writer, "OK")
+	expectError(t, writer, "NOPERM user writer has no permissions to run the 'SETK' command")
+	if v := reply(t, writer); v != nil {
+		t.Fatalf("expected a null reply, got %#v", v)
+	}
+}
+
+func TestACLAuthRedacted(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerAuth(app)
+	app.AddUser(&User{Name: "app", Password: "secret", Commands: []string{"+@all"}})
+	app.ctx.SlowLog.Configure(0, 8)
+	client := connect(t, app, l)
+
+	send(client, []string{"AUTH", "app", "wrong"}, []string{"AUTH", "app", "secret"})
+	expectError(t, client, errInvalidAuth.Error())
+	expect(t, client, "OK")
+
+	entries := app.ctx.SlowLog.Entries(-1)
+	if len(entries) != 2 {
+		t.Fatalf("expected both commands to be recorded, got %d entries", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Cmd != "AUTH" || len(entry.Args) != 1 || entry.Args[0] != redacted {
+			t.Fatalf("expected the arguments of AUTH to be redacted, got %v", entry.Args)
+		}
+	}
+}
+
+func TestACLCertificateIdentity(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	registerAuth(app)
+	app.AddUser(&User{Name: "reader", Password: "secret", Commands: []string{"+@read"}})
+	certs := newTestCertificates(t)
+
+	// the verified certificate names the user without a password
+	client := connectTLS(t, app, l, certs, "reader")
+	send(client, []string{"GETK", "a"}, []string{"SETK", "a", "1"})
+	if v := reply(t, client); v != nil {
+		t.Fatalf("expected a null reply, got %#v", v)
+	}
+	expectError(t, client, "NOPERM user reader has no permissions to run the 'SETK' command")
+
+	// certificates that do not name a user must authenticate as any other client
+	unknown := connectTLS(t, app, l, certs, "unknown")
+	send(unknown, []string{"GETK", "a"}, []string{"AUTH", "reader", "secret"}, []string{"GETK", "a"})
+	expectError(t, unknown, errNoAuth.Error())
+	expect(t, unknown, "OK")
+	if v := reply(t, unknown); v != nil {
+		t.Fatalf("expected a null reply, got %#v", v)
+	}
+
+	anonymous := connectTLS(t, app, l, certs, "")
+	send(anonymous, []string{"GETK", "a"})
+	expectError(t, anonymous, errNoAuth.Error())
+}
+
+func TestUnixTLSListener(t *testing.T) {
+	app := NewBroadcastServer()
+	t.Cleanup(app.Close)
+	registerStore(app)
+	certs := newTestCertificates(t)
+
+	path := filepath.Join(t.TempDir(), "broadcast.sock")
+	config := &tls.Config{Certificates: []tls.Certificate{certs.issue(t, "broadcast", x509.ExtKeyUsageServerAuth)}}
+	protocol := NewDefaultBroadcastServerProtocol()
+	l, err := app.AddUnixTLSListener(path, 0600, config, protocol)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := protocol.Initialize(app.ctx); err != nil {
+		t.Fatal(err)
+	} else if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the socket to be created with its mode, got %v", err)
+	}
+	go func() {
+		if conn, err := l.listener.Accept(); err == nil {
+			app.handleConnection(l, conn)
+		}
+	}()
+
+	conn, err := tls.Dial("unix", path, &tls.Config{RootCAs: certs.pool, ServerName: "broadcast"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _ := NewNetworkClient(conn)
+	defer client.Close()
+
+	send(client, []string{"SETK", "a", "1"})
+	expect(t, client, "OK")
+}
+
+func TestCommandTimeout(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	app.RegisterContextCommand(Command{Name: "WAITK", Usage: "WAITK"},
+		func(c context.Context, data interface{}, client ProtocolClient) error {
+			<-c.Done()
+			return c.Err()
+		})
+	client := connect(t, app, l)
+
+	// deadlines may change while commands are being dispatched
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			app.SetCommandTimeout("getk", time.Duration(i)*time.Second)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		send(client, []string{"GETK", "a"})
+		if v := reply(t, client); v != nil {
+			t.Fatalf("expected a null reply, got %#v", v)
+		}
+	}
+	<-done
+
+	app.SetCommandTimeout("", time.Hour)
+	app.SetCommandTimeout("waitk", 50*time.Millisecond)
+	if app.ctx.CommandTimeout("WAITK") != 50*time.Millisecond || app.ctx.CommandTimeout("SETK") != time.Hour {
+		t.Fatalf("expected the deadline of the command to take precedence over the default")
+	}
+	send(client, []string{"WAITK"})
+	expectError(t, client, context.DeadlineExceeded.Error())
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TextSink writes entries as human readable lines (i.e. [pid] time # message key=value)
+type TextSink struct {
+	w   io.Writer
+	pid int
+}
+
+// NewTextSink will create a sink that writes text lines to the given writer
+func NewTextSink(w io.Writer) *TextSink {
+	return &TextSink{w, os.Getpid()}
+}
+
+func (s *TextSink) Write(entry *Entry) error {
+	delim := "#"
+	if entry.Level != LevelInfo {
+		delim = strings.ToUpper(entry.Level.String()) + ":"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[%d] %s %s %s", s.pid, entry.Time.Format(time.RFC822), delim, entry.Message)
+	if entry.Err != nil {
+		fmt.Fprintf(&buf, " %v", entry.Err)
+	}
+	for _, field := range entry.Fields {
+		fmt.Fprintf(&buf, " %s=%v", field.Key, field.Value)
+	}
+	buf.WriteByte('\n')
+
+	_, err := s.w.Write(buf.Bytes())
+	return err
+}
+
+func (s *TextSink) Close() error {
+	return closeWriter(s.w)
+}
+
+// JSONSink writes entries as json objects, one per line
+type JSONSink struct {
+	w   io.Writer
+	pid int
+}
+
+// NewJSONSink will create a sink that writes json lines to the given writer
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w, os.Getpid()}
+}
+
+func (s *JSONSink) Write(entry *Entry) error {
+	obj := make(map[string]interface{}, len(entry.Fields)+5)
+	for _, field := range entry.Fields {
+		if err, ok := field.Value.(error); ok {
+			obj[field.Key] = err.Error()
+		} else {
+			obj[field.Key] = field.Value
+		}
+	}
+	obj["time"] = entry.Time.Format(time.RFC3339Nano)
+	obj["level"] = entry.Level.String()
+	obj["msg"] = entry.Message
+	obj["pid"] = s.pid
+	if entry.Err != nil {
+		obj["error"] = entry.Err.Error()
+	}
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+func (s *JSONSink) Close() error {
+	return closeWriter(s.w)
+}
+
+// closeWriter will close the writer of a sink unless it is one of the standard streams
+func closeWriter(w io.Writer) error {
+	if w == os.Stdout || w == os.Stderr {
+		return nil
+	} else if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// RotatingFile is a log file writer that rotates the file once it exceeds the maximum size,
+// keeping up to the given number of backups (path.1 being the most recent)
+type RotatingFile struct {
+	sync.Mutex
+
+	path       string   // path of the log file
+	maxSize    int64    // size in bytes the file is rotated at
+	maxBackups int      // number of rotated files to keep
+	file       *os.File // currently open log file
+	size       int64    // size of the currently open log file
+}
+
+// NewRotatingFile will open (or create) the log file at the given path for appending
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	return r.file.Close()
+}
+
+// open will open the log file for appending
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// rotate will shift the backups (dropping the oldest), move the log file to the first backup
+// and open a new log file
+func (r *RotatingFile) rotate() error {
+	r.file.Close()
+	if r.maxBackups > 0 {
+		for i := r.maxBackups - 1; i > 0; i-- {
+			os.Rename(r.path+"."+strconv.Itoa(i), r.path+"."+strconv.Itoa(i+1))
+		}
+		os.Rename(r.path, r.path+".1")
+	} else {
+		os.Remove(r.path)
+	}
+	return r.open()
+}
+
+// Configure will set the level of the logger and add a sink of the given format (text or json)
+// that writes to stdout, or to a rotating file when a path is given (maxSize in bytes)
+func (l *Logger) Configure(level string, format string, path string, maxSize int64, maxBackups int) error {
+	if len(level) > 0 {
+		lvl, err := ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		l.SetLevel(lvl)
+	}
+
+	var w io.Writer = os.Stdout
+	if len(path) > 0 {
+		file, err := NewRotatingFile(path, maxSize, maxBackups)
+		if err != nil {
+			return err
+		}
+		w = file
+	}
+
+	switch format {
+	case "", "text":
+		l.AddSink(NewTextSink(w))
+	case "json":
+		l.AddSink(NewJSONSink(w))
+	default:
+		closeWriter(w)
+		return errors.New("Invalid log format " + format + " specified, expected text or json")
+	}
+	return nil
+}
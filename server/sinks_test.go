@@ -0,0 +1,63 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// expectFile will ensure the file holds the given contents
+func expectFile(t *testing.T, path string, contents string) {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(b) != contents {
+		t.Fatalf("expected %s to hold %q, got %q", filepath.Base(path), contents, b)
+	}
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broadcast.log")
+	r, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// writes are never split, the file is rotated before a write that would exceed the size
+	for _, line := range []string{"a\n", "bbbbbb\n", "ccccc\n", "dd\n", "eeeeeeeeeeee\n", "f\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Close()
+
+	expectFile(t, path, "f\n")
+	expectFile(t, path+".1", "eeeeeeeeeeee\n")
+	expectFile(t, path+".2", "ccccc\ndd\n")
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected only 2 backups to be kept, got %v", err)
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broadcast.log")
+	if err := ioutil.WriteFile(path, []byte("existing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the size of the existing file counts towards the first rotation
+	r, err := NewRotatingFile(path, 12, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("ab\n"))
+	r.Write([]byte("cd\n"))
+	r.Close()
+
+	expectFile(t, path, "cd\n")
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatalf("expected no backups to be kept, got %v", err)
+	}
+}
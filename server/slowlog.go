@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// slowLogMaxArgs is the number of arguments of a command kept in the slow log
+var slowLogMaxArgs = 32
+
+// slowLogMaxArgLen is the number of bytes of an argument kept in the slow log
+var slowLogMaxArgLen = 128
+
+// SlowLogEntry is a command that took longer than the slow log threshold to run
+type SlowLogEntry struct {
+	Id       uint64        // unique id of the entry
+	Time     time.Time     // time the command started
+	Duration time.Duration // time the command took to run
+	Cmd      string        // name of the command
+	Args     []string      // arguments of the command (truncated)
+	Addr     string        // address of the client that ran the command
+}
+
+// SlowLog records the commands that take longer than a threshold to run in a bounded ring, the
+// oldest entries are discarded once the ring is full
+type SlowLog struct {
+	sync.Mutex
+
+	threshold time.Duration  // commands running at least this long are recorded (negative to disable)
+	maxLen    int            // maximum number of entries kept
+	entries   []SlowLogEntry // ring of entries
+	start     int            // index of the oldest entry in the ring
+	nextId    uint64         // id of the next entry
+}
+
+// NewSlowLog will create a slow log recording commands that run for at least the threshold
+func NewSlowLog(threshold time.Duration, maxLen int) *SlowLog {
+	slowlog := new(SlowLog)
+	slowlog.Configure(threshold, maxLen)
+	return slowlog
+}
+
+// Configure will change the threshold and the maximum number of entries, the newest entries are
+// kept when the slow log shrinks
+func (s *SlowLog) Configure(threshold time.Duration, maxLen int) {
+	s.Lock()
+	defer s.Unlock()
+	if maxLen < 0 {
+		maxLen = 0
+	}
+
+	entries := s.newest(maxLen)
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	s.threshold = threshold
+	s.maxLen = maxLen
+	s.entries = entries
+	s.start = 0
+}
+
+// Threshold will return the time commands must run for to be recorded
+func (s *SlowLog) Threshold() time.Duration {
+	s.Lock()
+	defer s.Unlock()
+	return s.threshold
+}
+
+// Record will add the command to the slow log if it ran for at least the threshold
+func (s *SlowLog) Record(cmd string, data interface{}, addr string, start time.Time, d time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	if s.threshold < 0 || d < s.threshold || s.maxLen == 0 {
+		return
+	}
+
+	entry := SlowLogEntry{s.nextId, start, d, cmd, truncateArgs(cmd, data), addr}
+	s.nextId++
+	if len(s.entries) < s.maxLen {
+		s.entries = append(s.entries, entry)
+	} else {
+		s.entries[s.start] = entry
+		s.start = (s.start + 1) % len(s.entries)
+	}
+}
+
+// Entries will return up to n of the newest entries, newest first (all entries when n is negative)
+func (s *SlowLog) Entries(n int) []SlowLogEntry {
+	s.Lock()
+	defer s.Unlock()
+	return s.newest(n)
+}
+
+// newest will return up to n of the newest entries, newest first, the caller holds the lock
+func (s *SlowLog) newest(n int) []SlowLogEntry {
+	if n < 0 || n > len(s.entries) {
+		n = len(s.entries)
+	}
+
+	entries := make([]SlowLogEntry, n)
+	for i := 0; i < n; i++ {
+		entries[i] = s.entries[(s.start+len(s.entries)-1-i)%len(s.entries)]
+	}
+	return entries
+}
+
+// Len will return the number of entries in the slow log
+func (s *SlowLog) Len() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.entries)
+}
+
+// Reset will discard every entry of the slow log
+func (s *SlowLog) Reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.entries = s.entries[:0]
+	s.start = 0
+}
+
+// truncateArgs will convert the arguments to strings, keeping at most slowLogMaxArgs arguments of
+// at most slowLogMaxArgLen bytes each, the arguments of redacted commands (i.e. AUTH) are never kept
+func truncateArgs(cmd string, data interface{}) []string {
+	if redactedCommands[cmd] {
+		return []string{redacted}
+	}
+
+	args := argList(data)
+
+	n := len(args)
+	if n > slowLogMaxArgs {
+		n = slowLogMaxArgs - 1
+	}
+
+	truncated := make([]string, 0, n+1)
+	for _, arg := range args[:n] {
+		s := ""
+		if b, ok := arg.([]byte); ok {
+			s = string(b)
+		} else {
+			s = fmt.Sprint(arg)
+		}
+
+		if len(s) > slowLogMaxArgLen {
+			s = fmt.Sprintf("%s... (%d more bytes)", s[:slowLogMaxArgLen], len(s)-slowLogMaxArgLen)
+		}
+		truncated = append(truncated, s)
+	}
+	if n < len(args) {
+		truncated = append(truncated, fmt.Sprintf("... (%d more arguments)", len(args)-n))
+	}
+	return truncated
+}
+
+// slowlog is the middleware that records the commands whose handlers take longer than the slow
+// log threshold to run
+func (ctx *BroadcastContext) slowlog(c context.Context, cmd string, data interface{}, client ProtocolClient, next Dispatcher) error {
+	start := time.Now()
+	err := next(c, cmd, data, client)
+	ctx.SlowLog.Record(cmd, data, client.Address(), start, time.Since(start))
+	return err
+}
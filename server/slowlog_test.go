@@ -0,0 +1,93 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// record will record a command of the given name that took d to run
+func record(s *SlowLog, cmd string, d time.Duration) {
+	s.Record(cmd, [][]byte{[]byte("arg")}, "127.0.0.1:1", time.Now(), d)
+}
+
+// expectEntries will ensure the entries are of the given commands in order
+func expectEntries(t *testing.T, entries []SlowLogEntry, cmds ...string) {
+	t.Helper()
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Cmd
+	}
+	if strings.Join(names, ",") != strings.Join(cmds, ",") {
+		t.Fatalf("expected entries %v, got %v", cmds, names)
+	}
+}
+
+func TestSlowLogThreshold(t *testing.T) {
+	s := NewSlowLog(10*time.Millisecond, 8)
+	record(s, "FAST", time.Millisecond)
+	record(s, "SLOW", 10*time.Millisecond)
+	record(s, "SLOWER", time.Second)
+	expectEntries(t, s.Entries(-1), "SLOWER", "SLOW")
+
+	entry := s.Entries(1)[0]
+	if entry.Id != 1 || entry.Duration != time.Second || entry.Addr != "127.0.0.1:1" || len(entry.Args) != 1 || entry.Args[0] != "arg" {
+		t.Fatalf("expected the newest entry to describe the command, got %+v", entry)
+	}
+
+	// a negative threshold disables the slow log
+	s.Configure(-1, 8)
+	record(s, "DISABLED", time.Hour)
+	if s.Len() != 2 {
+		t.Fatalf("expected nothing to be recorded while disabled, got %d entries", s.Len())
+	}
+}
+
+func TestSlowLogRing(t *testing.T) {
+	s := NewSlowLog(0, 3)
+	for i := 0; i < 5; i++ {
+		record(s, "CMD"+strconv.Itoa(i), time.Millisecond)
+	}
+	expectEntries(t, s.Entries(-1), "CMD4", "CMD3", "CMD2")
+	expectEntries(t, s.Entries(2), "CMD4", "CMD3")
+	if entries := s.Entries(1); entries[0].Id != 4 {
+		t.Fatalf("expected ids to keep increasing as entries are discarded, got %d", entries[0].Id)
+	}
+
+	// shrinking keeps the newest entries, growing keeps them all
+	s.Configure(0, 2)
+	expectEntries(t, s.Entries(-1), "CMD4", "CMD3")
+	s.Configure(0, 4)
+	record(s, "CMD5", time.Millisecond)
+	record(s, "CMD6", time.Millisecond)
+	expectEntries(t, s.Entries(-1), "CMD6", "CMD5", "CMD4", "CMD3")
+
+	s.Reset()
+	if s.Len() != 0 || len(s.Entries(-1)) != 0 {
+		t.Fatalf("expected the slow log to be empty once reset, got %d entries", s.Len())
+	}
+	record(s, "CMD7", time.Millisecond)
+	expectEntries(t, s.Entries(-1), "CMD7")
+}
+
+func TestSlowLogTruncatesArgs(t *testing.T) {
+	args := make([][]byte, slowLogMaxArgs+5)
+	for i := range args {
+		args[i] = []byte("a")
+	}
+	args[0] = []byte(strings.Repeat("b", slowLogMaxArgLen+10))
+
+	truncated := truncateArgs("SET", args)
+	if len(truncated) != slowLogMaxArgs {
+		t.Fatalf("expected %d arguments to be kept, got %d", slowLogMaxArgs, len(truncated))
+	} else if truncated[0] != strings.Repeat("b", slowLogMaxArgLen)+"... (10 more bytes)" {
+		t.Fatalf("expected the long argument to be truncated, got %q", truncated[0])
+	} else if last := truncated[len(truncated)-1]; last != "... (6 more arguments)" {
+		t.Fatalf("expected the remaining arguments to be counted, got %q", last)
+	}
+
+	if truncated := truncateArgs("AUTH", [][]byte{[]byte("user"), []byte("secret")}); len(truncated) != 1 || truncated[0] != redacted {
+		t.Fatalf("expected the arguments of AUTH to be redacted, got %v", truncated)
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InfoSections are the sections of the server status in the order they are reported
+var InfoSections = []string{"server", "clients", "memory", "commandstats", "backends"}
+
+// BackendInfo is implemented by backends that report their own statistics in the server status
+type BackendInfo interface {
+	Info() (map[string]interface{}, error)
+}
+
+// BackendStatus is a loaded backend along with the statistics it reports (if any)
+type BackendStatus struct {
+	Name string                 // name of the backend (i.e. stats.StatsBackend)
+	Info map[string]interface{} // statistics of backends implementing BackendInfo
+}
+
+// backendStatus will name the backend and gather its statistics
+func backendStatus(backend Backend) BackendStatus {
+	status := BackendStatus{Name: strings.TrimPrefix(fmt.Sprintf("%T", backend), "*")}
+	if b, ok := backend.(BackendInfo); ok {
+		if info, err := b.Info(); err == nil {
+			status.Info = info
+		}
+	}
+	return status
+}
+
+// Sections will group the status into the named sections (server, clients, memory, commandstats,
+// backends), every section is included when no names are given or a name is "all"
+func (status *BroadcastServerStatus) Sections(names ...string) (map[string]interface{}, error) {
+	if len(names) == 0 {
+		names = InfoSections
+	}
+
+	sections := make(map[string]interface{})
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "all":
+			return status.Sections()
+		case "server":
+			sections["server"] = map[string]interface{}{
+				"Name":          status.Name,
+				"Version":       status.Version,
+				"Pid":           status.Pid,
+				"Uptime":        status.Uptime,
+				"Listeners":     status.Listeners,
+				"NumGoroutines": status.NumGoroutines,
+				"NumCpu":        status.NumCpu,
+				"NumCgoCall":    status.NumCgoCall,
+				"NumInFlight":   status.NumInFlight,
+			}
+		case "clients":
+			sections["clients"] = map[string]interface{}{
+				"NumClients":            status.NumClients,
+				"NumMonitors":           status.NumMonitors,
+				"MaxClients":            status.MaxClients,
+				"NumAccepted":           status.NumAccepted,
+				"NumRejected":           status.NumRejected,
+				"NumRejectedMaxClients": status.NumRejectedMaxClients,
+				"NumRejectedPerIP":      status.NumRejectedPerIP,
+				"NumRejectedRate":       status.NumRejectedRate,
+				"NumRateLimited":        status.NumRateLimited,
+				"NumRateDropped":        status.NumRateDropped,
+				"RateLimitHits":         status.RateLimitHits,
+			}
+		case "memory":
+			sections["memory"] = status.Memory
+		case "commandstats":
+			sections["commandstats"] = status.Commands
+		case "backends":
+			sections["backends"] = status.Backends
+		default:
+			return nil, fmt.Errorf("unknown INFO section '%s'", name)
+		}
+	}
+	return sections, nil
+}
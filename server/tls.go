@@ -0,0 +1,49 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+// tlsConnection is implemented by connections that carry tls state (i.e. *tls.Conn)
+type tlsConnection interface {
+	ConnectionState() tls.ConnectionState
+}
+
+// NewTLSConfig will load the certificate and key used by tls listeners. When a client CA file is
+// given, client certificates are verified against it and can be required for every connection.
+func NewTLSConfig(certFile string, keyFile string, clientCAFile string, requireClientCert bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := new(tls.Config)
+	config.Certificates = []tls.Certificate{cert}
+	config.MinVersion = tls.VersionTLS12
+
+	if len(clientCAFile) > 0 {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in client CA file " + clientCAFile)
+		}
+
+		config.ClientCAs = pool
+		if requireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	} else if requireClientCert {
+		return nil, errors.New("client certificates cannot be required without a client CA")
+	}
+
+	return config, nil
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var errNestedMulti = errors.New("MULTI calls can not be nested")
+var errExecWithoutMulti = errors.New("EXEC without MULTI")
+var errDiscardWithoutMulti = errors.New("DISCARD without MULTI")
+var errWatchInMulti = errors.New("WATCH inside MULTI is not allowed")
+var errExecAbort = errors.New("EXECABORT Transaction discarded because of previous errors.")
+
+// transactionCommands are the commands that control a transaction, they are never queued
+var transactionCommands = map[string]bool{"MULTI": true, "EXEC": true, "DISCARD": true, "WATCH": true, "UNWATCH": true}
+
+// execKey marks the context of the commands executed by EXEC
+type execKey struct{}
+
+// transaction is the MULTI/WATCH state of a single client
+type transaction struct {
+	multi   bool                // true once MULTI has been called and commands are being queued
+	queued  []Request           // commands queued to run on EXEC
+	failed  bool                // true when a command failed to be queued, EXEC will abort
+	watched map[string]struct{} // keys being watched
+	dirty   bool                // true once a watched key has been modified, EXEC will fail
+}
+
+// Transactions tracks the transactions of every client. Every command dispatched through the server
+// holds a shared lock while it runs and EXEC holds it exclusively, so that the queued commands of a
+// transaction run atomically against every backend.
+//
+// The lock is deliberately a single lock for the whole server rather than one per backend or key:
+// backends are free to keep state across keys (i.e. counters feeding aggregate metrics) and commands
+// do not declare which backend they belong to, so nothing narrower can guarantee atomicity. The
+// trade-off is that while EXEC runs every other client waits, including clients working on
+// unrelated keys, so transactions are meant to be short.
+type Transactions struct {
+	sync.Mutex
+
+	exec     sync.RWMutex                       // shared by commands, exclusive while EXEC runs
+	clients  map[uint64]*transaction            // transaction state keyed by client id
+	watchers map[string]map[uint64]*transaction // transactions watching each key
+}
+
+// NewTransactions will create the transaction state of a server without any transactions
+func NewTransactions() *Transactions {
+	t := new(Transactions)
+	t.clients = make(map[uint64]*transaction)
+	t.watchers = make(map[string]map[uint64]*transaction)
+	return t
+}
+
+// Queuing will determine whether the client is within MULTI and its commands are being queued
+func (t *Transactions) Queuing(client ProtocolClient) bool {
+	t.Lock()
+	defer t.Unlock()
+	txn, ok := t.clients[client.Id()]
+	return ok && txn.multi
+}
+
+// state will return the transaction state of the client, creating it if necessary
+func (t *Transactions) state(client ProtocolClient) *transaction {
+	id := client.Id()
+	txn, ok := t.clients[id]
+	if !ok {
+		txn = &transaction{watched: make(map[string]struct{})}
+		t.clients[id] = txn
+		go t.watch(client)
+	}
+	return txn
+}
+
+// watch will wait for the client to exit and remove its transaction state
+func (t *Transactions) watch(client ProtocolClient) {
+	<-client.WaitExit()
+
+	t.Lock()
+	defer t.Unlock()
+	id := client.Id()
+	if txn, ok := t.clients[id]; ok {
+		t.unwatch(id, txn)
+		delete(t.clients, id)
+	}
+}
+
+// unwatch will stop watching the keys of the transaction, the caller holds the lock
+func (t *Transactions) unwatch(id uint64, txn *transaction) {
+	for key := range txn.watched {
+		delete(t.watchers[key], id)
+		if len(t.watchers[key]) == 0 {
+			delete(t.watchers, key)
+		}
+	}
+	txn.watched = make(map[string]struct{})
+	txn.dirty = false
+}
+
+// discard will discard the queued commands and watched keys of the transaction, returning the
+// state as it was before, the caller holds the lock
+func (t *Transactions) discard(id uint64, txn *transaction) transaction {
+	prev := *txn
+	t.unwatch(id, txn)
+	txn.multi = false
+	txn.queued = nil
+	txn.failed = false
+	return prev
+}
+
+// touch will mark the transactions watching any of the keys as dirty
+func (t *Transactions) touch(keys []string) {
+	t.Lock()
+	defer t.Unlock()
+	if len(t.watchers) == 0 {
+		return
+	}
+
+	for _, key := range keys {
+		for _, txn := range t.watchers[key] {
+			txn.dirty = true
+		}
+	}
+}
+
+// keyArgs will return the key arguments of the command as strings
+func keyArgs(help Command, data interface{}) []string {
+	args := argList(data)
+
+	keys := make([]string, 0)
+	for _, i := range help.KeyIndexes(len(args)) {
+		if b, ok := args[i].([]byte); ok {
+			keys = append(keys, string(b))
+		} else {
+			keys = append(keys, fmt.Sprint(args[i]))
+		}
+	}
+	return keys
+}
+
+// inExec will determine whether the command is being run by EXEC
+func inExec(c context.Context) bool {
+	return c.Value(execKey{}) != nil
+}
+
+// multi is the middleware that queues the commands of clients within MULTI, commands are checked
+// for permission and arity as they are queued and any failure aborts the transaction on EXEC
+func (ctx *BroadcastContext) multi(c context.Context, cmd string, data interface{}, client ProtocolClient, next Dispatcher) error {
+	if inExec(c) || (transactionCommands[cmd] && cmd != "MULTI") || !ctx.Transactions.Queuing(client) {
+		return next(c, cmd, data, client)
+	}
+
+	help, ok := ctx.CommandHelp[cmd]
+	var err error
+	if cmd == "MULTI" {
+		return errNestedMulti
+	} else if _, found := ctx.Commands[cmd]; !found {
+		err = ErrCmdNotFound
+	} else if ok && help.Flags.Has(FlagBlocking) {
+		err = fmt.Errorf("'%s' command is not allowed within a transaction", cmd)
+	} else {
+		err = ctx.authorize(c, cmd, data, client, func(c context.Context, cmd string, data interface{}, client ProtocolClient) error {
+			return ctx.validate(c, cmd, data, client, ctx.enqueue)
+		})
+	}
+
+	if err != nil {
+		ctx.Transactions.Lock()
+		ctx.Transactions.state(client).failed = true
+		ctx.Transactions.Unlock()
+	}
+	return err
+}
+
+// enqueue will queue the command to run on EXEC, fire and forget commands are queued without a reply
+func (ctx *BroadcastContext) enqueue(c context.Context, cmd string, data interface{}, client ProtocolClient) error {
+	ctx.Transactions.Lock()
+	txn := ctx.Transactions.state(client)
+	txn.queued = append(txn.queued, Request{cmd, data})
+	ctx.Transactions.Unlock()
+
+	if help, ok := ctx.CommandHelp[cmd]; ok && help.FireForget {
+		return nil
+	}
+	client.WriteString("QUEUED")
+	return client.Flush()
+}
+
+// atomic is the middleware that holds the shared transaction lock while a command runs (exclusive
+// while EXEC runs, pausing every other command on the server) and marks the keys modified by write
+// commands for any clients watching them
+func (ctx *BroadcastContext) atomic(c context.Context, cmd string, data interface{}, client ProtocolClient, next Dispatcher) error {
+	help, ok := ctx.CommandHelp[cmd]
+	if !inExec(c) && cmd != "EXEC" && !(ok && help.Flags.Has(FlagBlocking)) {
+		ctx.Transactions.exec.RLock()
+		defer ctx.Transactions.exec.RUnlock()
+	}
+
+	err := next(c, cmd, data, client)
+	if err == nil && ok && help.Flags.Has(FlagWrite) {
+		ctx.Transactions.touch(keyArgs(help, data))
+	}
+	return err
+}
+
+// multiCmd will start queuing the commands of the client
+func (ctx *BroadcastContext) multiCmd(c context.Context, data interface{}, client ProtocolClient) error {
+	ctx.Transactions.Lock()
+	ctx.Transactions.state(client).multi = true
+	ctx.Transactions.Unlock()
+
+	client.WriteString("OK")
+	return client.Flush()
+}
+
+// execCmd will run the queued commands of the client atomically and reply with an array of their
+// replies, or null when a watched key was modified
+func (ctx *BroadcastContext) execCmd(c context.Context, data interface{}, client ProtocolClient) error {
+	ctx.Transactions.exec.Lock()
+	defer ctx.Transactions.exec.Unlock()
+
+	ctx.Transactions.Lock()
+	txn, ok := ctx.Transactions.clients[client.Id()]
+	if !ok || !txn.multi {
+		ctx.Transactions.Unlock()
+		return errExecWithoutMulti
+	}
+	prev := ctx.Transactions.discard(client.Id(), txn)
+	ctx.Transactions.Unlock()
+
+	if prev.failed {
+		return errExecAbort
+	} else if prev.dirty {
+		client.WriteNull()
+		return client.Flush()
+	}
+
+	c = context.WithValue(c, execKey{}, true)
+	client.WriteLen('*', len(prev.queued))
+	for _, req := range prev.queued {
+		err := ctx.dispatch(c, req.Cmd, req.Args, client)
+		if err != nil {
+			client.WriteError(err)
+		} else if help, ok := ctx.CommandHelp[req.Cmd]; ok && help.FireForget {
+			client.WriteString("OK")
+		}
+	}
+	return client.Flush()
+}
+
+// discardCmd will discard the queued commands and watched keys of the client
+func (ctx *BroadcastContext) discardCmd(c context.Context, data interface{}, client ProtocolClient) error {
+	ctx.Transactions.Lock()
+	txn, ok := ctx.Transactions.clients[client.Id()]
+	if !ok || !txn.multi {
+		ctx.Transactions.Unlock()
+		return errDiscardWithoutMulti
+	}
+	ctx.Transactions.discard(client.Id(), txn)
+	ctx.Transactions.Unlock()
+
+	client.WriteString("OK")
+	return client.Flush()
+}
+
+// watchCmd will watch the given keys, EXEC fails if any of them is modified before it runs
+func (ctx *BroadcastContext) watchCmd(c context.Context, data interface{}, client ProtocolClient) error {
+	ctx.Transactions.Lock()
+	txn := ctx.Transactions.state(client)
+	if txn.multi {
+		ctx.Transactions.Unlock()
+		return errWatchInMulti
+	}
+
+	id := client.Id()
+	for _, key := range keyArgs(ctx.CommandHelp["WATCH"], data) {
+		txn.watched[key] = struct{}{}
+		if _, ok := ctx.Transactions.watchers[key]; !ok {
+			ctx.Transactions.watchers[key] = make(map[uint64]*transaction)
+		}
+		ctx.Transactions.watchers[key][id] = txn
+	}
+	ctx.Transactions.Unlock()
+
+	client.WriteString("OK")
+	return client.Flush()
+}
+
+// unwatchCmd will stop watching every key, queued commands are kept
+func (ctx *BroadcastContext) unwatchCmd(c context.Context, data interface{}, client ProtocolClient) error {
+	ctx.Transactions.Lock()
+	if txn, ok := ctx.Transactions.clients[client.Id()]; ok {
+		ctx.Transactions.unwatch(client.Id(), txn)
+	}
+	ctx.Transactions.Unlock()
+
+	client.WriteString("OK")
+	return client.Flush()
+}
+
+// registerTransactions will register the transaction commands
+func (ctx *BroadcastContext) registerTransactions() {
+	ctx.RegisterContextCommand(Command{Name: "MULTI", Description: "Marks the start of a transaction, commands are queued until EXEC", Usage: "MULTI",
+		Flags: FlagTransaction}, ctx.multiCmd)
+	// the queued commands write to the connection as they would have on their own (i.e. CLIENT KILL)
+	ctx.RegisterContextCommand(Command{Name: "EXEC", Description: "Executes the queued commands of the transaction atomically", Usage: "EXEC",
+		Flags: FlagTransaction | FlagDirect}, ctx.execCmd)
+	ctx.RegisterContextCommand(Command{Name: "DISCARD", Description: "Discards the queued commands of the transaction", Usage: "DISCARD",
+		Flags: FlagTransaction}, ctx.discardCmd)
+	ctx.RegisterContextCommand(Command{Name: "WATCH", Description: "Watches keys so that EXEC fails if any of them is modified", Usage: "WATCH key [key ...]",
+		MinArgs: 1, MaxArgs: Variadic, Flags: FlagTransaction, FirstKey: 1, LastKey: -1, Args: []ArgType{ArgKey}}, ctx.watchCmd)
+	ctx.RegisterContextCommand(Command{Name: "UNWATCH", Description: "Forgets the keys being watched", Usage: "UNWATCH",
+		Flags: FlagTransaction}, ctx.unwatchCmd)
+}
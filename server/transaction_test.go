@@ -0,0 +1,210 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransactionExec(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	client := connect(t, app, l)
+
+	send(client, []string{"MULTI"}, []string{"SETK", "a", "1"}, []string{"GETK", "a"}, []string{"EXEC"})
+	expect(t, client, "OK")
+	expect(t, client, "QUEUED")
+	expect(t, client, "QUEUED")
+	if v, ok := reply(t, client).([]interface{}); !ok || len(v) != 2 || v[0] != "OK" || v[1] != "1" {
+		t.Fatalf("expected the replies of the queued commands, got %#v", v)
+	}
+}
+
+func TestTransactionArityFailureAbortsExec(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	store := registerStore(app)
+	client := connect(t, app, l)
+
+	send(client, []string{"MULTI"}, []string{"SETK", "a", "1"}, []string{"SETK", "b"}, []string{"EXEC"})
+	expect(t, client, "OK")
+	expect(t, client, "QUEUED")
+	expectError(t, client, "wrong number of arguments for 'SETK' command (usage: SETK key value)")
+	expectError(t, client, errExecAbort.Error())
+
+	store.Lock()
+	defer store.Unlock()
+	if _, ok := store.values["a"]; ok {
+		t.Fatal("expected none of the queued commands to run")
+	}
+}
+
+func TestTransactionPermissionFailureAbortsExec(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	store := registerStore(app)
+	app.ctx.ACL.AddUser(&User{
+		Name:     DefaultUser,
+		Commands: []string{"+@read", "+@transaction"},
+	})
+	client := connect(t, app, l)
+
+	send(client, []string{"MULTI"}, []string{"GETK", "a"}, []string{"SETK", "a", "1"}, []string{"EXEC"})
+	expect(t, client, "OK")
+	expect(t, client, "QUEUED")
+	expectError(t, client, "NOPERM user default has no permissions to run the 'SETK' command")
+	expectError(t, client, errExecAbort.Error())
+
+	store.Lock()
+	defer store.Unlock()
+	if _, ok := store.values["a"]; ok {
+		t.Fatal("expected none of the queued commands to run")
+	}
+}
+
+func TestTransactionWatchDirtiedByAnotherClient(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	store := registerStore(app)
+	client := connect(t, app, l)
+	other := connect(t, app, l)
+
+	send(client, []string{"WATCH", "a"}, []string{"MULTI"}, []string{"SETK", "b", "1"})
+	expect(t, client, "OK")
+	expect(t, client, "OK")
+	expect(t, client, "QUEUED")
+
+	send(other, []string{"SETK", "a", "2"})
+	expect(t, other, "OK")
+
+	send(client, []string{"EXEC"})
+	if v := reply(t, client); v != nil {
+		t.Fatalf("expected a null reply, got %#v", v)
+	}
+
+	store.Lock()
+	defer store.Unlock()
+	if _, ok := store.values["b"]; ok {
+		t.Fatal("expected the queued commands not to run")
+	}
+}
+
+func TestTransactionWatchUntouched(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	client := connect(t, app, l)
+	other := connect(t, app, l)
+
+	send(client, []string{"WATCH", "a"}, []string{"MULTI"}, []string{"SETK", "b", "1"})
+	expect(t, client, "OK")
+	expect(t, client, "OK")
+	expect(t, client, "QUEUED")
+
+	// writes to other keys leave the transaction clean
+	send(other, []string{"SETK", "c", "2"})
+	expect(t, other, "OK")
+
+	send(client, []string{"EXEC"})
+	if v, ok := reply(t, client).([]interface{}); !ok || len(v) != 1 || v[0] != "OK" {
+		t.Fatalf("expected the replies of the queued commands, got %#v", v)
+	}
+}
+
+func TestTransactionUnwatch(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	client := connect(t, app, l)
+	other := connect(t, app, l)
+
+	send(client, []string{"WATCH", "a"}, []string{"UNWATCH"}, []string{"MULTI"}, []string{"SETK", "b", "1"})
+	expect(t, client, "OK")
+	expect(t, client, "OK")
+	expect(t, client, "OK")
+	expect(t, client, "QUEUED")
+
+	send(other, []string{"SETK", "a", "2"})
+	expect(t, other, "OK")
+
+	send(client, []string{"EXEC"})
+	if v, ok := reply(t, client).([]interface{}); !ok || len(v) != 1 || v[0] != "OK" {
+		t.Fatalf("expected the replies of the queued commands, got %#v", v)
+	}
+}
+
+func TestTransactionDiscard(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	store := registerStore(app)
+	client := connect(t, app, l)
+	other := connect(t, app, l)
+
+	send(client, []string{"WATCH", "a"}, []string{"MULTI"}, []string{"SETK", "b", "1"}, []string{"DISCARD"}, []string{"EXEC"})
+	expect(t, client, "OK")
+	expect(t, client, "OK")
+	expect(t, client, "QUEUED")
+	expect(t, client, "OK")
+	expectError(t, client, errExecWithoutMulti.Error())
+
+	// discarding also forgets the watched keys
+	send(other, []string{"SETK", "a", "2"})
+	expect(t, other, "OK")
+	send(client, []string{"MULTI"}, []string{"SETK", "c", "3"}, []string{"EXEC"})
+	expect(t, client, "OK")
+	expect(t, client, "QUEUED")
+	if v, ok := reply(t, client).([]interface{}); !ok || len(v) != 1 || v[0] != "OK" {
+		t.Fatalf("expected the replies of the queued commands, got %#v", v)
+	}
+
+	send(client, []string{"DISCARD"})
+	expectError(t, client, errDiscardWithoutMulti.Error())
+
+	store.Lock()
+	defer store.Unlock()
+	if _, ok := store.values["b"]; ok {
+		t.Fatal("expected the discarded commands not to run")
+	}
+}
+
+func TestTransactionStateRemovedOnExit(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	client := connect(t, app, l)
+
+	send(client, []string{"WATCH", "a", "b"}, []string{"MULTI"}, []string{"SETK", "a", "1"})
+	expect(t, client, "OK")
+	expect(t, client, "OK")
+	expect(t, client, "QUEUED")
+
+	txns := app.ctx.Transactions
+	txns.Lock()
+	if len(txns.clients) != 1 || len(txns.watchers) != 2 {
+		t.Fatalf("expected the transaction state of the client, got %d clients and %d watched keys", len(txns.clients), len(txns.watchers))
+	}
+	txns.Unlock()
+
+	client.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		txns.Lock()
+		clients, watchers := len(txns.clients), len(txns.watchers)
+		txns.Unlock()
+		if clients == 0 && watchers == 0 {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected the transaction state to be removed, got %d clients and %d watched keys", clients, watchers)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTransactionCommandsArity(t *testing.T) {
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	client := connect(t, app, l)
+
+	send(client, []string{"MULTI", "foo"}, []string{"EXEC", "bar"}, []string{"DISCARD", "baz"}, []string{"UNWATCH", "qux"}, []string{"WATCH"})
+	expectError(t, client, "wrong number of arguments for 'MULTI' command (usage: MULTI)")
+	expectError(t, client, "wrong number of arguments for 'EXEC' command (usage: EXEC)")
+	expectError(t, client, "wrong number of arguments for 'DISCARD' command (usage: DISCARD)")
+	expectError(t, client, "wrong number of arguments for 'UNWATCH' command (usage: UNWATCH)")
+	expectError(t, client, "wrong number of arguments for 'WATCH' command (usage: WATCH key [key ...])")
+
+	// the failed MULTI did not start a transaction
+	send(client, []string{"SETK", "a", "1"})
+	expect(t, client, "OK")
+}
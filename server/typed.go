@@ -0,0 +1,335 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	clientType  = reflect.TypeOf((*ProtocolClient)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	bytesType   = reflect.TypeOf([]byte(nil))
+	emptyType   = reflect.TypeOf(struct{}{})
+)
+
+// typedHandler calls an ordinary function with the arguments of a command decoded into the
+// types of its parameters and writes its return values to the client
+type typedHandler struct {
+	name       string        // name of the command
+	fireForget bool          // true to skip writing the return values
+	fn         reflect.Value // function being called
+	ctx        bool          // true if the function takes the context of the request first
+	client     bool          // true if the function takes the client (after the context)
+	params     []reflect.Type
+	variadic   bool // true if the last parameter is a variadic tail
+	err        bool // true if the last return value is an error
+}
+
+// newTypedHandler will inspect the signature of the function, parameters may start with a
+// context.Context and/or ProtocolClient followed by strings, []byte, bools, integers, floats or
+// interface{} (the last of which may be variadic), the last return value may be an error
+func newTypedHandler(cmd Command, fn interface{}) (*typedHandler, error) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func {
+		return nil, fmt.Errorf("handler of the '%s' command must be a function, got %s", cmd.Name, t)
+	}
+
+	h := &typedHandler{name: cmd.Name, fireForget: cmd.FireForget, fn: v, variadic: t.IsVariadic()}
+	i := 0
+	if i < t.NumIn() && t.In(i) == contextType {
+		h.ctx = true
+		i++
+	}
+	if i < t.NumIn() && t.In(i) == clientType {
+		h.client = true
+		i++
+	}
+	for ; i < t.NumIn(); i++ {
+		p := t.In(i)
+		if h.variadic && i == t.NumIn()-1 {
+			p = p.Elem()
+		}
+		if argType(p) == "" {
+			return nil, fmt.Errorf("parameter %d of the '%s' command handler has unsupported type %s", i+1, cmd.Name, p)
+		}
+		h.params = append(h.params, p)
+	}
+
+	if t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType {
+		h.err = true
+	}
+	return h, nil
+}
+
+// argType will return the declared argument type a parameter type is decoded as
+func argType(t reflect.Type) ArgType {
+	if t == bytesType {
+		return ArgString
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Interface:
+		return ArgString
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ArgInteger
+	case reflect.Float32, reflect.Float64:
+		return ArgFloat
+	}
+	return ""
+}
+
+// declare will fill in the arity and argument types of the command from the function signature
+// when the command does not declare them itself
+func (h *typedHandler) declare(cmd Command) Command {
+	if cmd.MinArgs == 0 && cmd.MaxArgs == 0 {
+		cmd.MinArgs = len(h.params)
+		cmd.MaxArgs = len(h.params)
+		if h.variadic {
+			cmd.MinArgs--
+			cmd.MaxArgs = Variadic
+		}
+	}
+
+	if len(cmd.Args) == 0 {
+		for _, p := range h.params {
+			cmd.Args = append(cmd.Args, argType(p))
+		}
+		for _, k := range cmd.KeyIndexes(len(h.params)) {
+			cmd.Args[k] = ArgKey
+		}
+	}
+	return cmd
+}
+
+// handle will decode the arguments, call the function and write its return values to the client
+func (h *typedHandler) handle(c context.Context, data interface{}, client ProtocolClient) error {
+	args := argList(data)
+
+	fixed := len(h.params)
+	if h.variadic {
+		fixed--
+	}
+	if len(args) < fixed || (!h.variadic && len(args) > fixed) {
+		return fmt.Errorf("wrong number of arguments for '%s' command", h.name)
+	}
+
+	in := make([]reflect.Value, 0, len(args)+2)
+	if h.ctx {
+		in = append(in, reflect.ValueOf(c))
+	}
+	if h.client {
+		in = append(in, reflect.ValueOf(&client).Elem())
+	}
+	for i, arg := range args {
+		p := h.params[len(h.params)-1]
+		if i < fixed {
+			p = h.params[i]
+		}
+
+		v, err := decodeArg(arg, p)
+		if err != nil {
+			return fmt.Errorf("argument %d of '%s' command is not a valid %s", i+1, h.name, argType(p))
+		}
+		in = append(in, v)
+	}
+
+	out := h.fn.Call(in)
+	if h.err {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return err
+		}
+		out = out[:len(out)-1]
+	}
+
+	if h.fireForget {
+		return nil
+	}
+	for _, v := range out {
+		if err := checkValue(v); err != nil {
+			return err
+		}
+	}
+
+	switch len(out) {
+	case 0:
+		client.WriteString("OK")
+	case 1:
+		writeValue(client, out[0])
+	default:
+		client.WriteLen('*', len(out))
+		for _, v := range out {
+			writeValue(client, v)
+		}
+	}
+	return client.Flush()
+}
+
+// decodeArg will convert an argument as it was read by any protocol to the given type
+func decodeArg(arg interface{}, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	if t.Kind() == reflect.Interface {
+		if arg != nil {
+			v.Set(reflect.ValueOf(arg))
+		}
+		return v, nil
+	}
+
+	var s string
+	switch a := arg.(type) {
+	case []byte:
+		if t == bytesType {
+			v.SetBytes(a)
+			return v, nil
+		}
+		s = string(a)
+	case string:
+		s = a
+	case nil:
+		return v, nil
+	default:
+		s = fmt.Sprint(a)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Slice:
+		v.SetBytes([]byte(s))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(n)
+	default:
+		return v, errors.New("unsupported type " + t.String())
+	}
+	return v, nil
+}
+
+// checkValue will ensure the return value can be written before any of it is written, unsigned
+// integers beyond the range of int64 cannot be written as integers
+func checkValue(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return fmt.Errorf("integer %d is out of range for a reply", v.Uint())
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return checkValue(v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type() != bytesType {
+			for i := 0; i < v.Len(); i++ {
+				if err := checkValue(v.Index(i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeValue will write a return value using the client's write methods, nil pointers, maps and
+// interfaces are written as null, slices as arrays, sets (map[string]struct{}) as sorted arrays of
+// their members and any other maps or structs as json
+func writeValue(client ProtocolClient, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return client.WriteNull()
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return client.WriteNull()
+		} else if v.Kind() == reflect.Interface {
+			return writeValue(client, v.Elem())
+		} else if v.Elem().Kind() == reflect.Struct {
+			return client.WriteJson(v.Interface())
+		}
+		return writeValue(client, v.Elem())
+	case reflect.String:
+		return client.WriteString(v.String())
+	case reflect.Bool:
+		return client.WriteBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return client.WriteInt64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return fmt.Errorf("integer %d is out of range for a reply", v.Uint())
+		}
+		return client.WriteInt64(int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return client.WriteFloat64(v.Float())
+	case reflect.Slice, reflect.Array:
+		if v.Type() == bytesType {
+			if v.IsNil() {
+				return client.WriteNull()
+			}
+			return client.WriteBytes(v.Bytes())
+		}
+		client.WriteLen('*', v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := writeValue(client, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.IsNil() {
+			return client.WriteNull()
+		} else if v.Type().Key().Kind() == reflect.String && v.Type().Elem() == emptyType {
+			members := make([]string, 0, v.Len())
+			for _, k := range v.MapKeys() {
+				members = append(members, k.String())
+			}
+			sort.Strings(members)
+			client.WriteLen('*', len(members))
+			for _, m := range members {
+				client.WriteString(m)
+			}
+			return nil
+		}
+		return client.WriteJson(v.Interface())
+	}
+
+	return client.WriteJson(v.Interface())
+}
+
+// RegisterFunc will register an ordinary function as the handler of the command (i.e.
+// func(key string, delta int64) (int64, error)), arguments are decoded from any protocol into
+// the parameter types and the return values are written to the client
+func (ctx *BroadcastContext) RegisterFunc(cmd Command, fn interface{}) error {
+	h, err := newTypedHandler(cmd, fn)
+	if err != nil {
+		return err
+	}
+
+	ctx.RegisterContextCommand(h.declare(cmd), h.handle)
+	return nil
+}
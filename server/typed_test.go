@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// bufferedClient will create a client writing its replies to the buffer
+func bufferedClient(buf *bytes.Buffer) *NetworkClient {
+	client := new(NetworkClient)
+	client.Writer = bufio.NewWriter(buf)
+	return client
+}
+
+func TestTypedDecodeArg(t *testing.T) {
+	var iface interface{}
+	tests := []struct {
+		arg      interface{}
+		t        reflect.Type
+		expected interface{}
+		err      bool
+	}{
+		{[]byte("foo"), reflect.TypeOf(""), "foo", false},
+		{"foo", reflect.TypeOf(""), "foo", false},
+		{[]byte("foo"), bytesType, []byte("foo"), false},
+		{"foo", bytesType, []byte("foo"), false},
+		{int64(12), reflect.TypeOf(""), "12", false},
+		{nil, reflect.TypeOf(""), "", false},
+		{[]byte("true"), reflect.TypeOf(false), true, false},
+		{[]byte("0"), reflect.TypeOf(false), false, false},
+		{[]byte("yes"), reflect.TypeOf(false), nil, true},
+		{[]byte("-42"), reflect.TypeOf(0), -42, false},
+		{int64(42), reflect.TypeOf(int64(0)), int64(42), false},
+		{[]byte("128"), reflect.TypeOf(int8(0)), nil, true},
+		{[]byte("1.5"), reflect.TypeOf(0), nil, true},
+		{[]byte("18446744073709551615"), reflect.TypeOf(uint64(0)), uint64(math.MaxUint64), false},
+		{[]byte("-1"), reflect.TypeOf(uint(0)), nil, true},
+		{[]byte("256"), reflect.TypeOf(uint8(0)), nil, true},
+		{[]byte("1.5"), reflect.TypeOf(float64(0)), 1.5, false},
+		{float64(2.25), reflect.TypeOf(float32(0)), float32(2.25), false},
+		{[]byte("abc"), reflect.TypeOf(float64(0)), nil, true},
+		{[]byte("foo"), reflect.TypeOf(&iface).Elem(), []byte("foo"), false},
+		{int64(3), reflect.TypeOf(&iface).Elem(), int64(3), false},
+		{nil, reflect.TypeOf(&iface).Elem(), nil, false},
+	}
+
+	for _, test := range tests {
+		v, err := decodeArg(test.arg, test.t)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected %#v to fail to decode as %s, got %#v", test.arg, test.t, v.Interface())
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expected %#v to decode as %s, got %v", test.arg, test.t, err)
+		} else if !reflect.DeepEqual(v.Interface(), test.expected) {
+			t.Errorf("expected %#v to decode as %#v, got %#v", test.arg, test.expected, v.Interface())
+		}
+	}
+}
+
+func TestTypedWriteValue(t *testing.T) {
+	var nilPtr *int64
+	var nilMap map[string]int
+	n := int64(7)
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "$-1\r\n"},
+		{"foo", "+foo\r\n"},
+		{true, "?1\r\n"},
+		{-3, ":-3\r\n"},
+		{uint8(255), ":255\r\n"},
+		{uint64(math.MaxInt64), ":9223372036854775807\r\n"},
+		{1.5, ".1.5\r\n"},
+		{[]byte("foo"), "$3\r\nfoo\r\n"},
+		{[]byte(nil), "$-1\r\n"},
+		{nilPtr, "$-1\r\n"},
+		{&n, ":7\r\n"},
+		{[]int64{1, 2}, "*2\r\n:1\r\n:2\r\n"},
+		{[]interface{}{"a", nil, []string{"b"}}, "*3\r\n+a\r\n$-1\r\n*1\r\n+b\r\n"},
+		{map[string]struct{}{"b": {}, "a": {}}, "*2\r\n+a\r\n+b\r\n"},
+		{map[string]struct{}{}, "*0\r\n"},
+		{nilMap, "$-1\r\n"},
+		{map[string]int{"a": 1}, "~json\r\n$7\r\n{\"a\":1}\r\n"},
+		{struct{ A int }{1}, "~json\r\n$7\r\n{\"A\":1}\r\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		client := bufferedClient(&buf)
+		if err := writeValue(client, reflect.ValueOf(test.value)); err != nil {
+			t.Errorf("expected %#v to be written, got %v", test.value, err)
+			continue
+		}
+		client.Flush()
+		if buf.String() != test.expected {
+			t.Errorf("expected %#v to be written as %q, got %q", test.value, test.expected, buf.String())
+		}
+	}
+}
+
+func TestTypedIntegerOutOfRange(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeValue(bufferedClient(&buf), reflect.ValueOf(uint64(math.MaxInt64+1))); err == nil {
+		t.Fatal("expected an unsigned integer beyond int64 to be rejected")
+	}
+
+	// nothing of the reply is written when any of the values is out of range
+	app, l := newTestServer(t, nil)
+	registerStore(app)
+	err := app.ctx.RegisterFunc(Command{Name: "BIG"}, func() (int64, []uint64) {
+		return 1, []uint64{2, math.MaxUint64}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := connect(t, app, l)
+
+	send(client, []string{"BIG"}, []string{"GETK", "a"})
+	expectError(t, client, "integer 18446744073709551615 is out of range for a reply")
+	if v := reply(t, client); v != nil {
+		t.Fatalf("expected a null reply, got %#v", v)
+	}
+}